@@ -0,0 +1,145 @@
+// Package idle detects targets without activity, so that their instances can
+// be stopped automatically.
+package idle
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CpuThreshold is the CPU usage, in percent of the instance, above which the
+// workspaces of a target are considered busy, e.g. running a build.
+const CpuThreshold = 10.0
+
+// Sample is the activity of a target at a point in time, see ProbeCommand.
+type Sample struct {
+	Time time.Time
+	// CpuTotal and CpuIdle are the cumulative CPU times of the instance, in clock ticks
+	CpuTotal uint64
+	CpuIdle  uint64
+	// RunningContainers is the number of running workspace containers of the target
+	RunningContainers int
+	// TerminalSessions is the number of processes attached to a pseudo-terminal,
+	// on the instance or in a workspace container, e.g. SSH sessions and IDE terminals
+	TerminalSessions int
+}
+
+// ProbeCommand returns the shell command that prints the activity of a target
+// on its instance, see ParseSample.
+func ProbeCommand(targetId string) string {
+	return strings.Join([]string{
+		"head -n 1 /proc/stat",
+		fmt.Sprintf("docker ps -q --filter label=daytona.target.id=%s | wc -l", targetId),
+		"ps -e -o tty= | grep -c '^pts/' || true",
+	}, "; ")
+}
+
+// ParseSample parses the output of ProbeCommand.
+func ParseSample(output string, t time.Time) (*Sample, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 {
+		return nil, fmt.Errorf("invalid activity probe output: %q", output)
+	}
+
+	// cpu user nice system idle iowait irq softirq steal ...
+	fields := strings.Fields(lines[0])
+	if len(fields) < 5 || fields[0] != "cpu" {
+		return nil, fmt.Errorf("invalid CPU times: %q", lines[0])
+	}
+
+	sample := &Sample{Time: t}
+	for i, field := range fields[1:] {
+		value, err := strconv.ParseUint(field, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CPU times: %q", lines[0])
+		}
+		sample.CpuTotal += value
+		// idle and iowait
+		if i == 3 || i == 4 {
+			sample.CpuIdle += value
+		}
+	}
+
+	runningContainers, err := strconv.Atoi(strings.TrimSpace(lines[1]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid running container count: %q", lines[1])
+	}
+	sample.RunningContainers = runningContainers
+
+	terminalSessions, err := strconv.Atoi(strings.TrimSpace(lines[2]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid terminal session count: %q", lines[2])
+	}
+	sample.TerminalSessions = terminalSessions
+
+	return sample, nil
+}
+
+// CpuPercent returns the CPU usage of the instance between two samples.
+func CpuPercent(previous, current *Sample) float64 {
+	if current.CpuTotal <= previous.CpuTotal || current.CpuIdle < previous.CpuIdle {
+		return 0
+	}
+
+	total := current.CpuTotal - previous.CpuTotal
+	idle := current.CpuIdle - previous.CpuIdle
+	if idle > total {
+		return 0
+	}
+
+	return float64(total-idle) / float64(total) * 100
+}
+
+// Tracker tracks the last activity of a target. A target is active while a
+// terminal session is open, or while its workspace containers keep the CPU
+// busy. CPU usage of the agent and the Docker daemon alone, without running
+// workspaces, does not count as activity.
+type Tracker struct {
+	stopAfter    time.Duration
+	lastActivity time.Time
+	lastSample   *Sample
+}
+
+// NewTracker returns a tracker of a target that was last active at start.
+func NewTracker(stopAfter time.Duration, start time.Time) *Tracker {
+	return &Tracker{
+		stopAfter:    stopAfter,
+		lastActivity: start,
+	}
+}
+
+// Observe records a sample of the target and returns true if it shows
+// activity. CPU usage is measured from the previous sample.
+func (t *Tracker) Observe(sample *Sample) bool {
+	previous := t.lastSample
+	t.lastSample = sample
+
+	active := sample.TerminalSessions > 0
+	if previous != nil && sample.RunningContainers > 0 && CpuPercent(previous, sample) >= CpuThreshold {
+		active = true
+	}
+
+	if active && sample.Time.After(t.lastActivity) {
+		t.lastActivity = sample.Time
+	}
+
+	return active
+}
+
+// LastActivity returns the time the target was last active.
+func (t *Tracker) LastActivity() time.Time {
+	return t.lastActivity
+}
+
+// ScheduledStop returns the time the target is stopped at, unless it becomes
+// active again.
+func (t *Tracker) ScheduledStop() time.Time {
+	return t.lastActivity.Add(t.stopAfter)
+}
+
+// IsIdle returns true if the target has not been active for the stop duration.
+func (t *Tracker) IsIdle(now time.Time) bool {
+	return !now.Before(t.ScheduledStop())
+}
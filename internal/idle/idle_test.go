@@ -0,0 +1,101 @@
+package idle
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSample(t *testing.T) {
+	now := time.Now()
+
+	sample, err := ParseSample("cpu  100 0 50 800 50 0 0 0 0 0\n2\n3\n", now)
+	if err != nil {
+		t.Fatalf("ParseSample() error = %v", err)
+	}
+
+	want := Sample{Time: now, CpuTotal: 1000, CpuIdle: 850, RunningContainers: 2, TerminalSessions: 3}
+	if *sample != want {
+		t.Errorf("ParseSample() = %+v, want %+v", *sample, want)
+	}
+
+	invalidOutputs := []string{
+		"",
+		"cpu 100 0 50 800\n2\n",
+		"intr 100 0 50 800\n2\n3",
+		"cpu 100 0 fifty 800\n2\n3",
+		"cpu 100 0 50 800\nCannot connect to the Docker daemon\n3",
+	}
+	for _, output := range invalidOutputs {
+		_, err := ParseSample(output, now)
+		if err == nil {
+			t.Errorf("ParseSample(%q) expected error", output)
+		}
+	}
+}
+
+func TestCpuPercent(t *testing.T) {
+	previous := &Sample{CpuTotal: 1000, CpuIdle: 900}
+
+	tests := []struct {
+		name    string
+		current *Sample
+		want    float64
+	}{
+		{name: "Busy", current: &Sample{CpuTotal: 2000, CpuIdle: 1400}, want: 50},
+		{name: "Idle", current: &Sample{CpuTotal: 2000, CpuIdle: 1900}, want: 0},
+		{name: "Rebooted", current: &Sample{CpuTotal: 100, CpuIdle: 50}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CpuPercent(previous, tt.current)
+			if got != tt.want {
+				t.Errorf("CpuPercent() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTracker(t *testing.T) {
+	start := time.Date(2024, 1, 1, 8, 0, 0, 0, time.UTC)
+	tracker := NewTracker(30*time.Minute, start)
+
+	if !tracker.ScheduledStop().Equal(start.Add(30 * time.Minute)) {
+		t.Errorf("ScheduledStop() = %v, want %v", tracker.ScheduledStop(), start.Add(30*time.Minute))
+	}
+
+	// Running containers without CPU usage are idle
+	if tracker.Observe(&Sample{Time: start.Add(time.Minute), CpuTotal: 1000, CpuIdle: 990, RunningContainers: 1}) {
+		t.Errorf("Observe() = true for the first sample without sessions")
+	}
+	if tracker.Observe(&Sample{Time: start.Add(2 * time.Minute), CpuTotal: 2000, CpuIdle: 1980, RunningContainers: 1}) {
+		t.Errorf("Observe() = true for idle containers")
+	}
+
+	// The CPU of the instance is busy, but no workspace is running
+	if tracker.Observe(&Sample{Time: start.Add(3 * time.Minute), CpuTotal: 3000, CpuIdle: 2000}) {
+		t.Errorf("Observe() = true for CPU usage without running containers")
+	}
+
+	// A workspace container is busy
+	busy := start.Add(4 * time.Minute)
+	if !tracker.Observe(&Sample{Time: busy, CpuTotal: 4000, CpuIdle: 2500, RunningContainers: 1}) {
+		t.Errorf("Observe() = false for busy containers")
+	}
+	if !tracker.LastActivity().Equal(busy) {
+		t.Errorf("LastActivity() = %v, want %v", tracker.LastActivity(), busy)
+	}
+
+	// A terminal session is open
+	session := start.Add(20 * time.Minute)
+	if !tracker.Observe(&Sample{Time: session, CpuTotal: 5000, CpuIdle: 3500, TerminalSessions: 1}) {
+		t.Errorf("Observe() = false for a terminal session")
+	}
+
+	if tracker.IsIdle(session.Add(29 * time.Minute)) {
+		t.Errorf("IsIdle() = true before the stop duration")
+	}
+	if !tracker.IsIdle(session.Add(30 * time.Minute)) {
+		t.Errorf("IsIdle() = false after the stop duration")
+	}
+}
@@ -0,0 +1,197 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchDays bounds the search for the next time matching a cron
+// expression, expressions such as Feb 30 never match
+const maxSearchDays = 4*366 + 1
+
+var monthNames = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+var weekdayNames = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Cron is a standard five field cron expression: minute, hour, day of month,
+// month and day of week. Fields support *, lists, ranges and steps, e.g.
+// 0 8 * * 1-5 or */15 9-17 * * mon-fri. Months and days of week can be
+// names, and Sunday is 0 or 7.
+type Cron struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// If both the day of month and the day of week are restricted, a time
+	// matching either matches the expression, as in cron
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: monthNames},
+	{name: "day of week", min: 0, max: 7, names: weekdayNames},
+}
+
+// ParseCron parses a five field cron expression.
+func ParseCron(expression string) (*Cron, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected %d fields, got %d", expression, len(cronFields), len(fields))
+	}
+
+	var bits [5]uint64
+	for i, field := range fields {
+		value, err := cronFields[i].parse(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expression, err)
+		}
+		bits[i] = value
+	}
+
+	// Sunday is both 0 and 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] = bits[4]&^(1<<7) | 1
+	}
+
+	return &Cron{
+		minutes:            bits[0],
+		hours:              bits[1],
+		days:               bits[2],
+		months:             bits[3],
+		weekdays:           bits[4],
+		daysRestricted:     fields[2] != "*",
+		weekdaysRestricted: fields[4] != "*",
+	}, nil
+}
+
+// parse parses a field of a cron expression into the set of its values.
+func (f cronField) parse(field string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		rangeExpr, stepExpr, hasStep := strings.Cut(item, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepExpr)
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %q", f.name, stepExpr)
+			}
+		}
+
+		start, end := f.min, f.max
+		if rangeExpr != "*" {
+			startExpr, endExpr, isRange := strings.Cut(rangeExpr, "-")
+
+			var err error
+			start, err = f.parseValue(startExpr)
+			if err != nil {
+				return 0, err
+			}
+
+			end = start
+			if isRange {
+				end, err = f.parseValue(endExpr)
+				if err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = f.max
+			}
+
+			if end < start {
+				return 0, fmt.Errorf("invalid %s range %q", f.name, rangeExpr)
+			}
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << value
+		}
+	}
+
+	return bits, nil
+}
+
+func (f cronField) parseValue(expr string) (int, error) {
+	if value, ok := f.names[strings.ToLower(expr)]; ok {
+		return value, nil
+	}
+
+	value, err := strconv.Atoi(expr)
+	if err != nil || value < f.min || value > f.max {
+		return 0, fmt.Errorf("invalid %s %q", f.name, expr)
+	}
+
+	return value, nil
+}
+
+// Matches returns true if the minute of t, in its location, matches the
+// expression.
+func (c *Cron) Matches(t time.Time) bool {
+	return c.matchesDay(t) && c.hours&(1<<t.Hour()) != 0 && c.minutes&(1<<t.Minute()) != 0
+}
+
+func (c *Cron) matchesDay(t time.Time) bool {
+	if c.months&(1<<int(t.Month())) == 0 {
+		return false
+	}
+
+	day := c.days&(1<<t.Day()) != 0
+	weekday := c.weekdays&(1<<int(t.Weekday())) != 0
+
+	if c.daysRestricted && c.weekdaysRestricted {
+		return day || weekday
+	}
+
+	return day && weekday
+}
+
+// Next returns the first minute after t that matches the expression, in the
+// location of t, or the zero time if no minute matches within four years.
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(0, 0, maxSearchDays)
+
+	for t.Before(end) {
+		next := t
+		switch {
+		case !c.matchesDay(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case c.hours&(1<<t.Hour()) == 0:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case c.minutes&(1<<t.Minute()) == 0:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+
+		// Skipping to the start of the next day or hour may go back across a
+		// daylight saving time change
+		if !next.After(t) {
+			next = t.Add(time.Minute)
+		}
+		t = next
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,124 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	validExpressions := []string{
+		"0 8 * * 1-5",
+		"*/15 9-17 * * mon-fri",
+		"30 6 1,15 * *",
+		"0 0 * jan-mar,DEC 0,7",
+		"5-59/10 * * * *",
+	}
+	for _, expression := range validExpressions {
+		_, err := ParseCron(expression)
+		if err != nil {
+			t.Errorf("ParseCron(%q) error = %v", expression, err)
+		}
+	}
+
+	invalidExpressions := []string{
+		"",
+		"0 8 * *",
+		"0 8 * * 1-5 2024",
+		"60 8 * * *",
+		"0 24 * * *",
+		"0 8 0 * *",
+		"0 8 * 13 *",
+		"0 8 * * 8",
+		"0 8 * * fri-mon",
+		"*/0 8 * * *",
+		"0 8 * * weekday",
+	}
+	for _, expression := range invalidExpressions {
+		_, err := ParseCron(expression)
+		if err == nil {
+			t.Errorf("ParseCron(%q) expected error", expression)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data not available: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		expression string
+		t          time.Time
+		want       time.Time
+	}{
+		{
+			name:       "Later the same day",
+			expression: "0 19 * * mon-fri",
+			t:          time.Date(2024, 3, 4, 10, 30, 15, 0, time.UTC),
+			want:       time.Date(2024, 3, 4, 19, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Strictly after",
+			expression: "0 8 * * *",
+			t:          time.Date(2024, 3, 4, 8, 0, 0, 0, time.UTC),
+			want:       time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Over the weekend",
+			expression: "0 8 * * 1-5",
+			t:          time.Date(2024, 3, 8, 9, 0, 0, 0, time.UTC),
+			want:       time.Date(2024, 3, 11, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Steps",
+			expression: "*/15 9-17 * * *",
+			t:          time.Date(2024, 3, 4, 17, 50, 0, 0, time.UTC),
+			want:       time.Date(2024, 3, 5, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Day of month or day of week",
+			expression: "0 0 13 * fri",
+			t:          time.Date(2024, 3, 9, 0, 0, 0, 0, time.UTC),
+			want:       time.Date(2024, 3, 13, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Leap day",
+			expression: "0 0 29 feb *",
+			t:          time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+			want:       time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Never",
+			expression: "0 0 30 feb *",
+			t:          time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "Across daylight saving time",
+			expression: "0 8 * * *",
+			t:          time.Date(2024, 3, 30, 9, 0, 0, 0, berlin),
+			want:       time.Date(2024, 3, 31, 8, 0, 0, 0, berlin),
+		},
+		{
+			name:       "Skipped hour",
+			expression: "30 2 * * *",
+			t:          time.Date(2024, 3, 31, 0, 0, 0, 0, berlin),
+			want:       time.Date(2024, 4, 1, 2, 30, 0, 0, berlin),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cron, err := ParseCron(tt.expression)
+			if err != nil {
+				t.Fatalf("ParseCron() error = %v", err)
+			}
+
+			got := cron.Next(tt.t)
+			if !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
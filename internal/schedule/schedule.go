@@ -0,0 +1,122 @@
+// Package schedule parses the start and stop schedules of targets.
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	// The provider binary may run on hosts without a zoneinfo database
+	_ "time/tzdata"
+)
+
+type Action string
+
+const (
+	ActionStart Action = "start"
+	ActionStop  Action = "stop"
+)
+
+// Schedule is the times a target is started and stopped at, in a timezone.
+// Either may be nil, e.g. to only stop targets at night.
+type Schedule struct {
+	Start    *Cron
+	Stop     *Cron
+	Location *time.Location
+}
+
+// Parse parses a schedule of the form "start=<cron>; stop=<cron>", e.g.
+// "start=0 8 * * mon-fri; stop=0 19 * * mon-fri", in the given IANA
+// timezone. An empty timezone is UTC.
+func Parse(schedule, timezone string) (*Schedule, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule timezone %q: %w", timezone, err)
+	}
+
+	s := &Schedule{Location: location}
+	for _, entry := range strings.Split(schedule, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		action, expression, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid schedule entry %q: expected start=<cron> or stop=<cron>", entry)
+		}
+
+		cron, err := ParseCron(expression)
+		if err != nil {
+			return nil, err
+		}
+
+		switch Action(strings.TrimSpace(action)) {
+		case ActionStart:
+			if s.Start != nil {
+				return nil, fmt.Errorf("schedule %q has more than one start", schedule)
+			}
+			s.Start = cron
+		case ActionStop:
+			if s.Stop != nil {
+				return nil, fmt.Errorf("schedule %q has more than one stop", schedule)
+			}
+			s.Stop = cron
+		default:
+			return nil, fmt.Errorf("invalid schedule action %q: expected start or stop", action)
+		}
+	}
+
+	if s.Start == nil && s.Stop == nil {
+		return nil, fmt.Errorf("schedule %q has neither a start nor a stop", schedule)
+	}
+
+	return s, nil
+}
+
+// Due returns the action that fell due after from, up to and including to.
+// If both fell due, e.g. after a long pause, the one that fell due last is
+// returned.
+func (s *Schedule) Due(from, to time.Time) (Action, bool) {
+	start := s.last(s.Start, from, to)
+	stop := s.last(s.Stop, from, to)
+
+	switch {
+	case start.IsZero() && stop.IsZero():
+		return "", false
+	case stop.IsZero() || start.After(stop):
+		return ActionStart, true
+	default:
+		return ActionStop, true
+	}
+}
+
+// NextStart returns the next scheduled start after t, or the zero time if the
+// target is never started on schedule.
+func (s *Schedule) NextStart(t time.Time) time.Time {
+	return s.next(s.Start, t)
+}
+
+// NextStop returns the next scheduled stop after t, or the zero time if the
+// target is never stopped on schedule.
+func (s *Schedule) NextStop(t time.Time) time.Time {
+	return s.next(s.Stop, t)
+}
+
+func (s *Schedule) next(cron *Cron, t time.Time) time.Time {
+	if cron == nil {
+		return time.Time{}
+	}
+
+	return cron.Next(t.In(s.Location))
+}
+
+// last returns the last time matching the cron expression after from, up to
+// and including to, or the zero time if none does.
+func (s *Schedule) last(cron *Cron, from, to time.Time) time.Time {
+	var last time.Time
+	for t := s.next(cron, from); !t.IsZero() && !t.After(to); t = s.next(cron, t) {
+		last = t
+	}
+	return last
+}
@@ -0,0 +1,78 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse("start=0 8 * * mon-fri; stop=0 19 * * mon-fri", "Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if s.Start == nil || s.Stop == nil || s.Location.String() != "Europe/Berlin" {
+		t.Errorf("Parse() = %+v, want a start, a stop and the Europe/Berlin location", s)
+	}
+
+	s, err = Parse("stop=0 19 * * *", "")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if s.Start != nil || s.Location != time.UTC {
+		t.Errorf("Parse() = %+v, want only a stop in UTC", s)
+	}
+
+	invalidSchedules := []struct {
+		schedule string
+		timezone string
+	}{
+		{schedule: "", timezone: "UTC"},
+		{schedule: "0 8 * * *", timezone: "UTC"},
+		{schedule: "start=0 8 * * *; start=0 9 * * *", timezone: "UTC"},
+		{schedule: "pause=0 8 * * *", timezone: "UTC"},
+		{schedule: "start=0 8 * *", timezone: "UTC"},
+		{schedule: "start=0 8 * * *", timezone: "Mars/Olympus_Mons"},
+	}
+	for _, tt := range invalidSchedules {
+		_, err := Parse(tt.schedule, tt.timezone)
+		if err == nil {
+			t.Errorf("Parse(%q, %q) expected error", tt.schedule, tt.timezone)
+		}
+	}
+}
+
+func TestScheduleDue(t *testing.T) {
+	s, err := Parse("start=0 8 * * mon-fri; stop=0 19 * * mon-fri", "UTC")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	monday := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 4, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name   string
+		from   time.Time
+		to     time.Time
+		want   Action
+		wantOk bool
+	}{
+		{name: "Nothing due", from: monday(9, 0), to: monday(9, 1)},
+		{name: "Start due", from: monday(7, 59), to: monday(8, 0), want: ActionStart, wantOk: true},
+		{name: "Start already passed", from: monday(8, 0), to: monday(8, 1)},
+		{name: "Stop due", from: monday(18, 59), to: monday(19, 0), want: ActionStop, wantOk: true},
+		{name: "Both due, stop last", from: monday(7, 0), to: monday(20, 0), want: ActionStop, wantOk: true},
+		{name: "Both due, start last", from: monday(18, 0), to: monday(18, 0).AddDate(0, 0, 1), want: ActionStart, wantOk: true},
+		{name: "Weekend", from: time.Date(2024, 3, 9, 7, 59, 0, 0, time.UTC), to: time.Date(2024, 3, 9, 8, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := s.Due(tt.from, tt.to)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("Due() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-aws/internal/idle"
+	awsutil "github.com/daytonaio/daytona-provider-aws/pkg/provider/util"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/agent/ssh/config"
+	"github.com/daytonaio/daytona/pkg/models"
+	"github.com/daytonaio/daytona/pkg/ssh"
+	"github.com/daytonaio/daytona/pkg/tailscale"
+	log "github.com/sirupsen/logrus"
+)
+
+// autoStopPollInterval is the interval at which the activity of targets is sampled
+const autoStopPollInterval = time.Minute
+
+// autoStopWatcher samples the activity of a running target and stops the
+// target once it has been idle for its Auto Stop After duration.
+type autoStopWatcher struct {
+	mutex   sync.Mutex
+	tracker *idle.Tracker
+	done    chan struct{}
+}
+
+// startAutoStop starts watching the activity of a running target, if it is
+// configured to be stopped when idle. The target is considered active when
+// the watch starts, e.g. when the target is started or the provider restarted.
+func (a *AWSProvider) startAutoStop(target *models.Target, targetOptions *types.TargetOptions) {
+	stopAfter := targetOptions.AutoStopDuration()
+	if stopAfter == 0 {
+		return
+	}
+
+	a.autoStopMutex.Lock()
+	defer a.autoStopMutex.Unlock()
+
+	if a.autoStopWatchers == nil {
+		a.autoStopWatchers = map[string]*autoStopWatcher{}
+	}
+
+	if _, ok := a.autoStopWatchers[target.Id]; ok {
+		return
+	}
+
+	watcher := &autoStopWatcher{
+		tracker: idle.NewTracker(stopAfter, time.Now()),
+		done:    make(chan struct{}),
+	}
+	a.autoStopWatchers[target.Id] = watcher
+
+	go a.watchActivity(target, targetOptions, watcher)
+}
+
+// stopAutoStop stops watching the activity of a target, e.g. because it is
+// stopped or destroyed.
+func (a *AWSProvider) stopAutoStop(targetId string) {
+	a.autoStopMutex.Lock()
+	defer a.autoStopMutex.Unlock()
+
+	watcher, ok := a.autoStopWatchers[targetId]
+	if !ok {
+		return
+	}
+
+	close(watcher.done)
+	delete(a.autoStopWatchers, targetId)
+}
+
+// getAutoStop returns the time a watched target was last active and the time
+// it will be stopped at if it stays idle.
+func (a *AWSProvider) getAutoStop(targetId string) (lastActivity time.Time, scheduledStop time.Time, ok bool) {
+	a.autoStopMutex.Lock()
+	watcher, ok := a.autoStopWatchers[targetId]
+	a.autoStopMutex.Unlock()
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	return watcher.tracker.LastActivity(), watcher.tracker.ScheduledStop(), true
+}
+
+func (a *AWSProvider) watchActivity(target *models.Target, targetOptions *types.TargetOptions, watcher *autoStopWatcher) {
+	ticker := time.NewTicker(autoStopPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-watcher.done:
+			return
+		case <-ticker.C:
+		}
+
+		// A target is only stopped right after a successful sample, so that it
+		// is not stopped while its agent is unreachable, e.g. restarting
+		sample, err := a.probeActivity(target.Id)
+		if err != nil {
+			log.Debugf("Failed to sample the activity of target %s: %s", target.Id, err)
+			continue
+		}
+
+		watcher.mutex.Lock()
+		watcher.tracker.Observe(sample)
+		isIdle := watcher.tracker.IsIdle(sample.Time)
+		lastActivity := watcher.tracker.LastActivity()
+		watcher.mutex.Unlock()
+
+		if !isIdle {
+			continue
+		}
+
+		a.autoStopMutex.Lock()
+		if a.autoStopWatchers[target.Id] != watcher {
+			// The target was stopped or destroyed in the meantime
+			a.autoStopMutex.Unlock()
+			return
+		}
+		delete(a.autoStopWatchers, target.Id)
+		a.autoStopMutex.Unlock()
+
+		a.autoStopTarget(target, targetOptions, lastActivity)
+		return
+	}
+}
+
+func (a *AWSProvider) autoStopTarget(target *models.Target, targetOptions *types.TargetOptions, lastActivity time.Time) {
+	logWriter, cleanupFunc := a.getTargetLogWriter(target.Id, target.Name)
+	defer cleanupFunc()
+
+	logWriter.Write([]byte(fmt.Sprintf("No activity since %s, stopping target\n", lastActivity.Format(time.RFC3339))))
+
+	err := awsutil.StopTarget(target, targetOptions, logWriter)
+	if err != nil {
+		logWriter.Write([]byte("Failed to stop idle target: " + err.Error() + "\n"))
+		return
+	}
+
+	logWriter.Write([]byte("Idle target stopped\n"))
+}
+
+// probeActivity samples the activity of a target on its instance, over an SSH
+// session to the agent of the target.
+func (a *AWSProvider) probeActivity(targetId string) (*idle.Sample, error) {
+	tsnetConn, err := a.getTsnetConn()
+	if err != nil {
+		return nil, err
+	}
+
+	sshClient, err := tailscale.NewSshClient(tsnetConn, &ssh.SessionConfig{
+		Hostname: targetId,
+		Port:     config.SSH_PORT,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer sshClient.Close()
+
+	session, err := sshClient.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	output, err := session.Output(idle.ProbeCommand(targetId))
+	if err != nil {
+		return nil, err
+	}
+
+	return idle.ParseSample(string(output), time.Now())
+}
@@ -15,6 +15,10 @@ import (
 )
 
 func (a *AWSProvider) getTsnetConn() (*tsnet.Server, error) {
+	// The connection is shared with the auto stop watchers of the targets
+	a.tsnetConnMutex.Lock()
+	defer a.tsnetConnMutex.Unlock()
+
 	if a.tsnetConn == nil {
 		tsnetConn, err := tailscale.GetConnection(&tailscale.TsnetConnConfig{
 			AuthKey:    *a.NetworkKey,
@@ -60,6 +64,8 @@ func (a *AWSProvider) getDockerClient(targetId string) (docker.IDockerClient, er
 		return nil, err
 	}
 
+	// The Docker daemon only listens on the loopback interface of the instance and is
+	// reached through the tailnet, where the agent forwards the connection to localhost.
 	remoteHost := fmt.Sprintf("tcp://%s:2375", targetId)
 	cli, err := client.NewClientWithOpts(client.WithDialContext(tsnetConn.Dial), client.WithHost(remoteHost), client.WithAPIVersionNegotiation())
 	if err != nil {
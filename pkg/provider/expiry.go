@@ -0,0 +1,175 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+	awsutil "github.com/daytonaio/daytona-provider-aws/pkg/provider/util"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+	log "github.com/sirupsen/logrus"
+)
+
+// expiryPollInterval is the interval at which the expiry of targets is checked
+const expiryPollInterval = time.Minute
+
+// expiryWatcher warns ahead of the expiry of a target, and applies its TTL
+// action once it expires.
+type expiryWatcher struct {
+	done chan struct{}
+}
+
+// startExpiry starts watching the expiry of a target, if it has a TTL. Once
+// the TTL action is applied, the target is no longer watched, but its watcher
+// is kept until stopExpiry so that the action is not applied again.
+func (a *AWSProvider) startExpiry(target *models.Target, targetOptions *types.TargetOptions) {
+	if targetOptions.TTLDuration() == 0 {
+		return
+	}
+
+	a.expiryMutex.Lock()
+	defer a.expiryMutex.Unlock()
+
+	if a.expiryWatchers == nil {
+		a.expiryWatchers = map[string]*expiryWatcher{}
+	}
+
+	if _, ok := a.expiryWatchers[target.Id]; ok {
+		return
+	}
+
+	watcher := &expiryWatcher{
+		done: make(chan struct{}),
+	}
+	a.expiryWatchers[target.Id] = watcher
+
+	go a.watchExpiry(target, targetOptions, watcher)
+}
+
+// stopExpiry stops watching the expiry of a target, e.g. because it is
+// destroyed.
+func (a *AWSProvider) stopExpiry(targetId string) {
+	a.expiryMutex.Lock()
+	defer a.expiryMutex.Unlock()
+
+	watcher, ok := a.expiryWatchers[targetId]
+	if !ok {
+		return
+	}
+
+	close(watcher.done)
+	delete(a.expiryWatchers, targetId)
+}
+
+func (a *AWSProvider) watchExpiry(target *models.Target, targetOptions *types.TargetOptions, watcher *expiryWatcher) {
+	ticker := time.NewTicker(expiryPollInterval)
+	defer ticker.Stop()
+
+	var expiresAt time.Time
+	// The zero time logs the last warning that is already due when the watch starts
+	var lastCheck time.Time
+	for {
+		// The expiry is read from the instance, it is only known once the instance is launched
+		if expiresAt.IsZero() {
+			var watch bool
+			expiresAt, watch = a.getExpiry(target, targetOptions)
+			if !watch {
+				return
+			}
+		}
+
+		if !expiresAt.IsZero() {
+			now := time.Now()
+			if !now.Before(expiresAt) {
+				a.expireTarget(target, targetOptions, expiresAt)
+				return
+			}
+
+			warning, ok := awsutil.DueExpiryWarning(expiresAt, lastCheck, now)
+			if ok {
+				a.warnExpiry(target, targetOptions, expiresAt, warning)
+			}
+			lastCheck = now
+		}
+
+		select {
+		case <-watcher.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getExpiry returns the expiry of a target, and whether the target still needs
+// to be watched. The zero time is returned if the expiry could not be read yet.
+func (a *AWSProvider) getExpiry(target *models.Target, targetOptions *types.TargetOptions) (time.Time, bool) {
+	instance, err := awsutil.GetInstance(target, targetOptions)
+	if errors.Is(err, awsutil.ErrInstanceNotFound) {
+		return time.Time{}, false
+	}
+	if err != nil {
+		log.Debugf("Failed to get the instance of target %s: %s", target.Id, err)
+		return time.Time{}, true
+	}
+
+	expiresAt, err := awsutil.GetExpiry(instance)
+	if err != nil {
+		log.Debugf("Failed to get the expiry of target %s: %s", target.Id, err)
+		return time.Time{}, false
+	}
+
+	// The instance was launched before the target had a TTL
+	if expiresAt.IsZero() {
+		return time.Time{}, false
+	}
+
+	// An expired target that is already stopped has nothing left to do
+	if !time.Now().Before(expiresAt) && targetOptions.TTLAction != types.TTLActionTerminate &&
+		*instance.State.Name == ec2.InstanceStateNameStopped {
+		return time.Time{}, false
+	}
+
+	return expiresAt, true
+}
+
+func (a *AWSProvider) warnExpiry(target *models.Target, targetOptions *types.TargetOptions, expiresAt time.Time, warning time.Duration) {
+	logWriter, cleanupFunc := a.getTargetLogWriter(target.Id, target.Name)
+	defer cleanupFunc()
+
+	logWriter.Write([]byte(fmt.Sprintf("Warning: target expires at %s, in less than %s. It will then be %s\n",
+		expiresAt.Format(time.RFC3339), warning, getTTLActionDescription(targetOptions))))
+}
+
+// expireTarget applies the TTL action of an expired target.
+func (a *AWSProvider) expireTarget(target *models.Target, targetOptions *types.TargetOptions, expiresAt time.Time) {
+	logWriter, cleanupFunc := a.getTargetLogWriter(target.Id, target.Name)
+	defer cleanupFunc()
+
+	logWriter.Write([]byte(fmt.Sprintf("Target expired at %s, it is %s\n", expiresAt.Format(time.RFC3339), getTTLActionDescription(targetOptions))))
+
+	a.stopAutoStop(target.Id)
+
+	if targetOptions.TTLAction == types.TTLActionTerminate {
+		a.stopSchedule(target.Id)
+
+		err := awsutil.DeleteTarget(target, targetOptions)
+		if err != nil {
+			logWriter.Write([]byte("Failed to terminate expired target: " + err.Error() + "\n"))
+		}
+		return
+	}
+
+	err := awsutil.StopTarget(target, targetOptions, logWriter)
+	if err != nil && !errors.Is(err, awsutil.ErrInstanceNotFound) {
+		logWriter.Write([]byte("Failed to stop expired target: " + err.Error() + "\n"))
+	}
+}
+
+func getTTLActionDescription(targetOptions *types.TargetOptions) string {
+	if targetOptions.TTLAction == types.TTLActionTerminate {
+		return "terminated and its resources deleted"
+	}
+	return "stopped"
+}
@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"os"
+	"path/filepath"
+
+	logwriters "github.com/daytonaio/daytona-provider-aws/internal/log"
+	awsutil "github.com/daytonaio/daytona-provider-aws/pkg/provider/util"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+// orphanAuditLogFileName is the name of the file, under the base path, to
+// which the orphans found and the actions taken on them are appended.
+const orphanAuditLogFileName = "orphans-audit.log"
+
+// CollectOrphans finds the resources of targets that no longer exist on the
+// Daytona server, in the region and with the credentials of the target
+// options, and deletes them after the default grace period if deleteOrphans
+// is set. With dryRun, the orphans that would be deleted are only reported.
+func (a *AWSProvider) CollectOrphans(targetOptionsJson string, knownTargetIds []string, deleteOrphans, dryRun bool) ([]*awsutil.Orphan, error) {
+	logWriter := &logwriters.InfoLogWriter{}
+
+	targetOptions, err := types.ParseTargetOptions(targetOptionsJson)
+	if err != nil {
+		logWriter.Write([]byte("Failed to parse target options: " + err.Error() + "\n"))
+		return nil, err
+	}
+
+	collectionOpts := &awsutil.OrphanCollectionOptions{
+		KnownTargetIds: knownTargetIds,
+		Delete:         deleteOrphans,
+		DryRun:         dryRun,
+	}
+
+	if a.BasePath != nil {
+		auditLog, err := os.OpenFile(filepath.Join(*a.BasePath, orphanAuditLogFileName), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			logWriter.Write([]byte("Failed to open the orphan audit log: " + err.Error() + "\n"))
+			return nil, err
+		}
+		defer auditLog.Close()
+
+		collectionOpts.AuditLog = auditLog
+	}
+
+	orphans, err := awsutil.CollectOrphans(targetOptions, collectionOpts, logWriter)
+	if err != nil {
+		logWriter.Write([]byte("Failed to collect orphans: " + err.Error() + "\n"))
+		return orphans, err
+	}
+
+	return orphans, nil
+}
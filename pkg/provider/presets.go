@@ -0,0 +1,116 @@
+package provider
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	awsutil "github.com/daytonaio/daytona-provider-aws/pkg/provider/util"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/provider"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// presetFileNames are the names of the files, under the base path, from which
+// operators can add their own presets.
+var presetFileNames = []string{"presets.yaml", "presets.yml", "presets.json"}
+
+// loadPresetTargetConfigs loads the built-in presets and the presets from the
+// preset file under the base path. A preset from the file replaces a built-in
+// preset with the same name. Invalid presets are logged and skipped.
+func loadPresetTargetConfigs(basePath string) []provider.TargetConfig {
+	presets := types.GetBuiltinPresetTargetConfigs()
+
+	filePresets, err := readPresetFile(basePath)
+	if err != nil {
+		log.Errorf("Failed to read preset file: %v", err)
+	}
+
+	for _, filePreset := range filePresets {
+		replaced := false
+		for i, preset := range presets {
+			if preset.Name == filePreset.Name {
+				presets[i] = filePreset
+				replaced = true
+			}
+		}
+		if !replaced {
+			presets = append(presets, filePreset)
+		}
+	}
+
+	targetConfigs := []provider.TargetConfig{}
+	for _, preset := range presets {
+		options, err := preset.GetOptionsJson()
+		if err != nil {
+			log.Errorf("Skipping invalid preset: %v", err)
+			continue
+		}
+
+		targetConfigs = append(targetConfigs, provider.TargetConfig{
+			Name:    preset.Name,
+			Options: options,
+		})
+	}
+
+	return targetConfigs
+}
+
+// readPresetFile reads the presets from the first preset file found under the
+// base path. No presets are returned if there is no preset file.
+func readPresetFile(basePath string) ([]types.PresetTargetConfig, error) {
+	for _, fileName := range presetFileNames {
+		filePath := filepath.Join(basePath, fileName)
+
+		content, err := os.ReadFile(filePath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var presets []types.PresetTargetConfig
+		if filepath.Ext(fileName) == ".json" {
+			err = json.Unmarshal(content, &presets)
+		} else {
+			err = yaml.Unmarshal(content, &presets)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", filePath, err)
+		}
+
+		return presets, nil
+	}
+
+	return nil, nil
+}
+
+// checkPresetKmsKeys checks the KMS keys of the presets, other than the key of
+// the default target options, which is checked with the other requirements.
+func (a *AWSProvider) checkPresetKmsKeys(defaultOptions *types.TargetOptions) []provider.RequirementStatus {
+	checked := map[string]bool{
+		defaultOptions.Region + "/" + defaultOptions.KmsKeyId: true,
+	}
+
+	var results []provider.RequirementStatus
+	for _, preset := range a.presets {
+		targetOptions, err := types.ParseTargetOptions(preset.Options)
+		if err != nil || targetOptions.KmsKeyId == "" {
+			continue
+		}
+
+		key := targetOptions.Region + "/" + targetOptions.KmsKeyId
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+
+		results = append(results, awsutil.CheckKmsKey(fmt.Sprintf("%s of preset %s", awsutil.RequirementKmsKey, preset.Name), targetOptions))
+	}
+
+	return results
+}
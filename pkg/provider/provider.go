@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"path"
+	"sync"
 	"time"
 
+	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/daytonaio/daytona-provider-aws/internal"
 	logwriters "github.com/daytonaio/daytona-provider-aws/internal/log"
 	awsutil "github.com/daytonaio/daytona-provider-aws/pkg/provider/util"
@@ -37,6 +39,14 @@ type AWSProvider struct {
 	WorkspaceLogsDir   *string
 	TargetLogsDir      *string
 	tsnetConn          *tsnet.Server
+	tsnetConnMutex     sync.Mutex
+	presets            []provider.TargetConfig
+	autoStopWatchers   map[string]*autoStopWatcher
+	autoStopMutex      sync.Mutex
+	scheduleWatchers   map[string]*scheduleWatcher
+	scheduleMutex      sync.Mutex
+	expiryWatchers     map[string]*expiryWatcher
+	expiryMutex        sync.Mutex
 }
 
 func (a *AWSProvider) Initialize(req provider.InitializeProviderRequest) (*util.Empty, error) {
@@ -51,6 +61,7 @@ func (a *AWSProvider) Initialize(req provider.InitializeProviderRequest) (*util.
 	a.ServerPort = &req.ServerPort
 	a.WorkspaceLogsDir = &req.WorkspaceLogsDir
 	a.TargetLogsDir = &req.TargetLogsDir
+	a.presets = loadPresetTargetConfigs(req.BasePath)
 
 	return new(util.Empty), nil
 }
@@ -67,7 +78,12 @@ func (a *AWSProvider) GetInfo() (models.ProviderInfo, error) {
 }
 
 func (a *AWSProvider) GetPresetTargetConfigs() (*[]provider.TargetConfig, error) {
-	return new([]provider.TargetConfig), nil
+	presets := a.presets
+	if presets == nil {
+		presets = []provider.TargetConfig{}
+	}
+
+	return &presets, nil
 }
 
 func (a *AWSProvider) CreateTarget(targetReq *provider.TargetRequest) (*util.Empty, error) {
@@ -83,14 +99,26 @@ func (a *AWSProvider) CreateTarget(targetReq *provider.TargetRequest) (*util.Emp
 		return nil, err
 	}
 
-	ec2spinner := logwriters.ShowSpinner(logWriter, "Creating EC2 instance", "EC2 instance created")
-	initScript := fmt.Sprintf(`curl -sfL -H "Authorization: Bearer %s" %s | bash`, targetReq.Target.ApiKey, *a.DaytonaDownloadUrl)
+	err = a.createTarget(targetReq, targetOptions, logWriter)
+	if err != nil {
+		a.rollbackTarget(targetReq, targetOptions, logWriter, err)
+		return nil, err
+	}
 
-	err = awsutil.CreateTarget(targetReq.Target, targetOptions, initScript)
+	a.startAutoStop(targetReq.Target, targetOptions)
+	a.startSchedule(targetReq.Target, targetOptions)
+	a.startExpiry(targetReq.Target, targetOptions)
+
+	return new(util.Empty), nil
+}
+
+func (a *AWSProvider) createTarget(targetReq *provider.TargetRequest, targetOptions *types.TargetOptions, logWriter io.Writer) error {
+	ec2spinner := logwriters.ShowSpinner(logWriter, "Creating EC2 instance", "EC2 instance created")
+	err := awsutil.CreateTarget(targetReq.Target, targetOptions, a.getInitScript(targetReq), logWriter)
 	close(ec2spinner)
 	if err != nil {
 		logWriter.Write([]byte("Failed to create workspace: " + err.Error() + "\n"))
-		return nil, err
+		return err
 	}
 
 	agentSpinner := logwriters.ShowSpinner(logWriter, "Waiting for the agent to start", "Agent started")
@@ -99,13 +127,19 @@ func (a *AWSProvider) CreateTarget(targetReq *provider.TargetRequest) (*util.Emp
 	close(agentSpinner)
 	if err != nil {
 		logWriter.Write([]byte("Failed to dial: " + err.Error() + "\n"))
-		return nil, err
+		return err
+	}
+
+	// The instance only fetches uploaded user data on its first boot
+	err = awsutil.DeleteUserData(targetReq.Target, targetOptions)
+	if err != nil {
+		logWriter.Write([]byte("Failed to delete uploaded user data: " + err.Error() + "\n"))
 	}
 
 	client, err := a.getDockerClient(targetReq.Target.Id)
 	if err != nil {
 		logWriter.Write([]byte("Failed to get client: " + err.Error() + "\n"))
-		return nil, err
+		return err
 	}
 
 	targetId := getTargetDir(targetReq.Target.Id)
@@ -115,11 +149,154 @@ func (a *AWSProvider) CreateTarget(targetReq *provider.TargetRequest) (*util.Emp
 	})
 	if err != nil {
 		logWriter.Write([]byte("Failed to create ssh client: " + err.Error() + "\n"))
-		return new(util.Empty), err
+		return err
 	}
 	defer sshClient.Close()
 
-	return new(util.Empty), client.CreateTarget(targetReq.Target, targetId, logWriter, sshClient)
+	return client.CreateTarget(targetReq.Target, targetId, logWriter, sshClient)
+}
+
+// getInitScript returns the script that installs the Daytona agent on the
+// instance of a target.
+func (a *AWSProvider) getInitScript(targetReq *provider.TargetRequest) string {
+	// The API key is read from the target env vars on the instance so that it
+	// is not embedded in the user data
+	if targetReq.Target.EnvVars == nil {
+		targetReq.Target.EnvVars = map[string]string{}
+	}
+	if _, ok := targetReq.Target.EnvVars["DAYTONA_SERVER_API_KEY"]; !ok {
+		targetReq.Target.EnvVars["DAYTONA_SERVER_API_KEY"] = targetReq.Target.ApiKey
+	}
+
+	return fmt.Sprintf(`curl -sfL -H "Authorization: Bearer $DAYTONA_SERVER_API_KEY" %s | bash`, *a.DaytonaDownloadUrl)
+}
+
+// rollbackTarget removes the resources of a target whose creation failed, so
+// that no instance keeps running untracked. If the target is configured to be
+// kept on failure, its instance is tagged as failed and left up for inspection.
+func (a *AWSProvider) rollbackTarget(targetReq *provider.TargetRequest, targetOptions *types.TargetOptions, logWriter io.Writer, reason error) {
+	if targetOptions.KeepOnFailure {
+		err := awsutil.MarkTargetFailed(targetReq.Target, targetOptions, reason)
+		if err != nil {
+			logWriter.Write([]byte("Failed to mark target as failed: " + err.Error() + "\n"))
+			return
+		}
+		logWriter.Write([]byte("Target instance kept for inspection and tagged as failed\n"))
+		return
+	}
+
+	rollbackSpinner := logwriters.ShowSpinner(logWriter, "Rolling back target resources", "Target resources rolled back")
+	err := awsutil.RollbackTarget(targetReq.Target, targetOptions)
+	close(rollbackSpinner)
+	if err != nil {
+		logWriter.Write([]byte("Failed to roll back target resources: " + err.Error() + "\n"))
+	}
+}
+
+// RecreateTarget replaces the instance of a target with a new instance
+// launched with the current target options, e.g. to apply a new image or
+// instance type. The workspaces are kept on the data volume of the target and
+// restarted once the agent of the new instance is started.
+//
+// RecreateTarget is not part of the provider plugin interface, so the Daytona
+// server never calls it. It is meant for Go programs that use the provider as
+// a library.
+func (a *AWSProvider) RecreateTarget(targetReq *provider.TargetRequest) (*util.Empty, error) {
+	if a.DaytonaDownloadUrl == nil {
+		return nil, errors.New("DaytonaDownloadUrl not set. Did you forget to call Initialize")
+	}
+	logWriter, cleanupFunc := a.getTargetLogWriter(targetReq.Target.Id, targetReq.Target.Name)
+	defer cleanupFunc()
+
+	targetOptions, err := types.ParseTargetOptions(targetReq.Target.TargetConfig.Options)
+	if err != nil {
+		logWriter.Write([]byte("Failed to parse target options: " + err.Error() + "\n"))
+		return nil, err
+	}
+
+	a.stopAutoStop(targetReq.Target.Id)
+
+	err = a.recreateTarget(targetReq, targetOptions, logWriter)
+	if err != nil {
+		return nil, err
+	}
+
+	a.startAutoStop(targetReq.Target, targetOptions)
+
+	return new(util.Empty), nil
+}
+
+func (a *AWSProvider) recreateTarget(targetReq *provider.TargetRequest, targetOptions *types.TargetOptions, logWriter io.Writer) error {
+	ec2spinner := logwriters.ShowSpinner(logWriter, "Recreating EC2 instance", "EC2 instance recreated")
+	err := awsutil.RecreateTarget(targetReq.Target, targetOptions, a.getInitScript(targetReq), logWriter)
+	close(ec2spinner)
+	if err != nil {
+		logWriter.Write([]byte("Failed to recreate instance: " + err.Error() + "\n"))
+		return err
+	}
+
+	agentSpinner := logwriters.ShowSpinner(logWriter, "Waiting for the agent to start", "Agent started")
+	err = a.waitForDial(targetReq.Target.Id, 10*time.Minute)
+	close(agentSpinner)
+	if err != nil {
+		logWriter.Write([]byte("Failed to dial: " + err.Error() + "\n"))
+		a.rollbackRecreatedTarget(targetReq, targetOptions, logWriter)
+		return err
+	}
+
+	err = awsutil.DeleteUserData(targetReq.Target, targetOptions)
+	if err != nil {
+		logWriter.Write([]byte("Failed to delete uploaded user data: " + err.Error() + "\n"))
+	}
+
+	dockerClient, err := a.getDockerClient(targetReq.Target.Id)
+	if err != nil {
+		logWriter.Write([]byte("Failed to get docker client: " + err.Error() + "\n"))
+		return err
+	}
+
+	sshClient, err := tailscale.NewSshClient(a.tsnetConn, &ssh.SessionConfig{
+		Hostname: targetReq.Target.Id,
+		Port:     config.SSH_PORT,
+	})
+	if err != nil {
+		logWriter.Write([]byte("Failed to create ssh client: " + err.Error() + "\n"))
+		return err
+	}
+	defer sshClient.Close()
+
+	// The workspace containers are kept in the Docker data root on the data
+	// volume, they only need to be started again
+	for i := range targetReq.Target.Workspaces {
+		workspace := &targetReq.Target.Workspaces[i]
+		logWriter.Write([]byte(fmt.Sprintf("Starting workspace %s\n", workspace.Name)))
+
+		err = dockerClient.StartWorkspace(&docker.CreateWorkspaceOptions{
+			Workspace:    workspace,
+			WorkspaceDir: getWorkspaceDir(&provider.WorkspaceRequest{Workspace: workspace}),
+			LogWriter:    logWriter,
+			SshClient:    sshClient,
+		}, *a.DaytonaDownloadUrl)
+		if err != nil {
+			// The instance is recreated, a workspace that fails to start can be started again on its own
+			logWriter.Write([]byte(fmt.Sprintf("Failed to start workspace %s: %s\n", workspace.Name, err.Error())))
+		}
+	}
+
+	return nil
+}
+
+// rollbackRecreatedTarget removes the new instance of a target whose agent
+// failed to start. The data volume is kept, so the target can be recreated again.
+func (a *AWSProvider) rollbackRecreatedTarget(targetReq *provider.TargetRequest, targetOptions *types.TargetOptions, logWriter io.Writer) {
+	rollbackSpinner := logwriters.ShowSpinner(logWriter, "Rolling back the new instance", "New instance rolled back")
+	err := awsutil.RollbackRecreatedTarget(targetReq.Target, targetOptions)
+	close(rollbackSpinner)
+	if err != nil {
+		logWriter.Write([]byte("Failed to roll back the new instance: " + err.Error() + "\n"))
+		return
+	}
+	logWriter.Write([]byte("The data volume of the target is kept, recreate the target again to retry\n"))
 }
 
 func (a *AWSProvider) StartTarget(targetReq *provider.TargetRequest) (*util.Empty, error) {
@@ -132,17 +309,80 @@ func (a *AWSProvider) StartTarget(targetReq *provider.TargetRequest) (*util.Empt
 		return nil, err
 	}
 
+	a.startSchedule(targetReq.Target, targetOptions)
+
+	// The expiry is read again, e.g. after the expiry tag was updated to extend the lifetime of the target
+	a.stopExpiry(targetReq.Target.Id)
+	a.startExpiry(targetReq.Target, targetOptions)
+
+	err = awsutil.StartTarget(targetReq.Target, targetOptions, logWriter)
+	if errors.Is(err, awsutil.ErrInstanceNotFound) {
+		logWriter.Write([]byte("Failed to start target: the instance no longer exists, it was terminated outside of Daytona. Delete and recreate the target\n"))
+		return nil, err
+	}
+	if errors.Is(err, awsutil.ErrMultipleInstances) {
+		logWriter.Write([]byte("Failed to start target: " + err.Error() + ". Terminate the duplicate instances\n"))
+		return nil, err
+	}
+	if errors.Is(err, awsutil.ErrTargetExpired) {
+		logWriter.Write([]byte("Failed to start target: " + err.Error() + ", or destroy the target\n"))
+		return nil, err
+	}
+	if err != nil {
+		logWriter.Write([]byte("Failed to start target: " + err.Error() + "\n"))
+		return nil, err
+	}
+
 	err = a.waitForDial(targetReq.Target.Id, 10*time.Minute)
 	if err != nil {
 		logWriter.Write([]byte("Failed to dial: " + err.Error() + "\n"))
 		return nil, err
 	}
 
-	err = awsutil.StartTarget(targetReq.Target, targetOptions)
+	a.startAutoStop(targetReq.Target, targetOptions)
+
+	return new(util.Empty), nil
+}
+
+// ResizeTarget changes the instance type of a target to the instance type of
+// its target options. Targets are also resized when they are started.
+//
+// Like RecreateTarget, ResizeTarget is not part of the provider plugin
+// interface.
+func (a *AWSProvider) ResizeTarget(targetReq *provider.TargetRequest) (*util.Empty, error) {
+	logWriter, cleanupFunc := a.getTargetLogWriter(targetReq.Target.Id, targetReq.Target.Name)
+	defer cleanupFunc()
+
+	targetOptions, err := types.ParseTargetOptions(targetReq.Target.TargetConfig.Options)
 	if err != nil {
+		logWriter.Write([]byte("Failed to parse target options: " + err.Error() + "\n"))
+		return nil, err
+	}
+
+	instance, err := awsutil.GetInstance(targetReq.Target, targetOptions)
+	if err != nil {
+		logWriter.Write([]byte("Failed to get machine: " + err.Error() + "\n"))
+		return nil, err
+	}
+
+	err = awsutil.ResizeTarget(targetReq.Target, targetOptions, logWriter)
+	if err != nil {
+		logWriter.Write([]byte("Failed to resize target: " + err.Error() + "\n"))
 		return nil, err
 	}
 
+	if *instance.State.Name != ec2.InstanceStateNameRunning && *instance.State.Name != ec2.InstanceStateNamePending {
+		return new(util.Empty), nil
+	}
+
+	err = a.waitForDial(targetReq.Target.Id, 10*time.Minute)
+	if err != nil {
+		logWriter.Write([]byte("Failed to dial: " + err.Error() + "\n"))
+		return nil, err
+	}
+
+	a.startAutoStop(targetReq.Target, targetOptions)
+
 	return new(util.Empty), nil
 }
 
@@ -156,7 +396,21 @@ func (a *AWSProvider) StopTarget(targetReq *provider.TargetRequest) (*util.Empty
 		return nil, err
 	}
 
-	return new(util.Empty), awsutil.StopTarget(targetReq.Target, targetOptions)
+	a.stopAutoStop(targetReq.Target.Id)
+	a.startSchedule(targetReq.Target, targetOptions)
+
+	err = awsutil.StopTarget(targetReq.Target, targetOptions, logWriter)
+	if errors.Is(err, awsutil.ErrInstanceNotFound) {
+		// Nothing is running or billed if the instance is gone, the target can still be destroyed
+		logWriter.Write([]byte("Target instance no longer exists, nothing to stop\n"))
+		return new(util.Empty), nil
+	}
+	if err != nil {
+		logWriter.Write([]byte("Failed to stop target: " + err.Error() + "\n"))
+		return nil, err
+	}
+
+	return new(util.Empty), nil
 }
 
 func (a *AWSProvider) DestroyTarget(targetReq *provider.TargetRequest) (*util.Empty, error) {
@@ -169,7 +423,17 @@ func (a *AWSProvider) DestroyTarget(targetReq *provider.TargetRequest) (*util.Em
 		return nil, err
 	}
 
-	return new(util.Empty), awsutil.DeleteTarget(targetReq.Target, targetOptions)
+	a.stopAutoStop(targetReq.Target.Id)
+	a.stopSchedule(targetReq.Target.Id)
+	a.stopExpiry(targetReq.Target.Id)
+
+	err = awsutil.DeleteTarget(targetReq.Target, targetOptions)
+	if err != nil {
+		logWriter.Write([]byte("Failed to destroy target: " + err.Error() + "\n"))
+		return nil, err
+	}
+
+	return new(util.Empty), nil
 }
 
 func (a *AWSProvider) GetTargetProviderMetadata(targetReq *provider.TargetRequest) (string, error) {
@@ -183,10 +447,16 @@ func (a *AWSProvider) GetTargetProviderMetadata(targetReq *provider.TargetReques
 	}
 
 	instance, err := awsutil.GetInstance(targetReq.Target, targetOptions)
+	if errors.Is(err, awsutil.ErrInstanceNotFound) {
+		return getTargetMetadataJson(types.TargetMetadata{State: types.TargetStateMissing})
+	}
+	if errors.Is(err, awsutil.ErrMultipleInstances) {
+		logWriter.Write([]byte("Failed to get machine: " + err.Error() + "\n"))
+		return getTargetMetadataJson(types.TargetMetadata{State: types.TargetStateDuplicate})
+	}
 	if err != nil {
 		logWriter.Write([]byte("Failed to get machine: " + err.Error() + "\n"))
 		return "", err
-
 	}
 
 	tags := map[string]string{}
@@ -194,12 +464,67 @@ func (a *AWSProvider) GetTargetProviderMetadata(targetReq *provider.TargetReques
 		tags[*tag.Key] = *tag.Value
 	}
 
+	spotInterruption, err := awsutil.GetSpotInterruption(targetReq.Target, targetOptions, instance)
+	if err != nil {
+		logWriter.Write([]byte("Failed to get spot interruption: " + err.Error() + "\n"))
+		return "", err
+	}
+
+	volumeEncrypted, volumeKmsKeyId, err := awsutil.GetVolumeEncryption(targetReq.Target, targetOptions, instance)
+	if err != nil {
+		logWriter.Write([]byte("Failed to get volume encryption: " + err.Error() + "\n"))
+		return "", err
+	}
+
 	metadata := types.TargetMetadata{
-		InstanceId: *instance.InstanceId,
-		IsRunning:  instance.State.String() == "running",
-		Created:    instance.LaunchTime.String(),
-		Tags:       tags,
+		InstanceId:       *instance.InstanceId,
+		State:            *instance.State.Name,
+		IsRunning:        *instance.State.Name == ec2.InstanceStateNameRunning,
+		Created:          instance.LaunchTime.String(),
+		Tags:             tags,
+		ImageId:          *instance.ImageId,
+		ImageName:        tags["ImageName"],
+		MarketType:       awsutil.GetMarketType(instance),
+		SpotInterruption: spotInterruption,
+		VolumeEncrypted:  volumeEncrypted,
+		VolumeKmsKeyId:   volumeKmsKeyId,
+	}
+
+	// Watching resumes for targets that were running when the provider restarted
+	if metadata.IsRunning {
+		a.startAutoStop(targetReq.Target, targetOptions)
+	} else {
+		a.stopAutoStop(targetReq.Target.Id)
+	}
+	a.startSchedule(targetReq.Target, targetOptions)
+	a.startExpiry(targetReq.Target, targetOptions)
+
+	lastActivity, scheduledStop, ok := a.getAutoStop(targetReq.Target.Id)
+	if ok {
+		metadata.LastActivity = lastActivity.Format(time.RFC3339)
+		metadata.ScheduledStop = scheduledStop.Format(time.RFC3339)
+	}
+
+	expiresAt, err := awsutil.GetExpiry(instance)
+	if err != nil {
+		logWriter.Write([]byte("Failed to get expiry: " + err.Error() + "\n"))
+	}
+	if !expiresAt.IsZero() {
+		metadata.ExpiresAt = expiresAt.Format(time.RFC3339)
 	}
+
+	nextStart, nextStop := getNextScheduledActions(targetOptions, time.Now())
+	if !nextStart.IsZero() {
+		metadata.NextScheduledStart = nextStart.Format(time.RFC3339)
+	}
+	if !nextStop.IsZero() {
+		metadata.NextScheduledStop = nextStop.Format(time.RFC3339)
+	}
+
+	return getTargetMetadataJson(metadata)
+}
+
+func getTargetMetadataJson(metadata types.TargetMetadata) (string, error) {
 	jsonMetadata, err := json.Marshal(metadata)
 	if err != nil {
 		return "", err
@@ -208,8 +533,24 @@ func (a *AWSProvider) GetTargetProviderMetadata(targetReq *provider.TargetReques
 	return string(jsonMetadata), nil
 }
 
+// CheckRequirements checks the requirements against the default target
+// options, which are taken from the target config manifest and the environment,
+// and the KMS keys of the presets.
 func (a *AWSProvider) CheckRequirements() (*[]provider.RequirementStatus, error) {
-	results := []provider.RequirementStatus{}
+	targetOptions, err := types.GetDefaultTargetOptions()
+	if err != nil {
+		results := []provider.RequirementStatus{
+			{
+				Name:   "Target options",
+				Met:    false,
+				Reason: err.Error(),
+			},
+		}
+		return &results, nil
+	}
+
+	results := awsutil.CheckRequirements(targetOptions)
+	results = append(results, a.checkPresetKmsKeys(targetOptions)...)
 	return &results, nil
 }
 
@@ -20,7 +20,7 @@ var (
 	awsProvider   = &AWSProvider{}
 	targetOptions = &types.TargetOptions{
 		Region:          region,
-		ImageId:         "ami-04a81a99f5ec58529",
+		ImageId:         types.DefaultImageId,
 		InstanceType:    "t2.micro",
 		DeviceName:      "/dev/sda1",
 		VolumeSize:      10,
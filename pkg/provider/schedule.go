@@ -0,0 +1,135 @@
+package provider
+
+import (
+	"errors"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-aws/internal/schedule"
+	awsutil "github.com/daytonaio/daytona-provider-aws/pkg/provider/util"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+// schedulePollInterval is the interval at which the schedules of targets are checked
+const schedulePollInterval = time.Minute
+
+// scheduleWatcher starts and stops a target at the times of its schedule.
+type scheduleWatcher struct {
+	done chan struct{}
+}
+
+// startSchedule starts enforcing the schedule of a target, if it has one.
+// Only the starts and stops that fall due from now on are enforced, so a
+// target started or stopped manually stays so until the next one.
+func (a *AWSProvider) startSchedule(target *models.Target, targetOptions *types.TargetOptions) {
+	targetSchedule, err := targetOptions.GetSchedule()
+	if err != nil || targetSchedule == nil {
+		return
+	}
+
+	a.scheduleMutex.Lock()
+	defer a.scheduleMutex.Unlock()
+
+	if a.scheduleWatchers == nil {
+		a.scheduleWatchers = map[string]*scheduleWatcher{}
+	}
+
+	if _, ok := a.scheduleWatchers[target.Id]; ok {
+		return
+	}
+
+	watcher := &scheduleWatcher{
+		done: make(chan struct{}),
+	}
+	a.scheduleWatchers[target.Id] = watcher
+
+	go a.watchSchedule(target, targetOptions, targetSchedule, watcher)
+}
+
+// stopSchedule stops enforcing the schedule of a target, e.g. because it is
+// destroyed.
+func (a *AWSProvider) stopSchedule(targetId string) {
+	a.scheduleMutex.Lock()
+	defer a.scheduleMutex.Unlock()
+
+	watcher, ok := a.scheduleWatchers[targetId]
+	if !ok {
+		return
+	}
+
+	close(watcher.done)
+	delete(a.scheduleWatchers, targetId)
+}
+
+func (a *AWSProvider) watchSchedule(target *models.Target, targetOptions *types.TargetOptions, targetSchedule *schedule.Schedule, watcher *scheduleWatcher) {
+	ticker := time.NewTicker(schedulePollInterval)
+	defer ticker.Stop()
+
+	lastCheck := time.Now()
+	for {
+		select {
+		case <-watcher.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Starts and stops that fell due while the previous one ran are caught up
+		now := time.Now()
+		action, ok := targetSchedule.Due(lastCheck, now)
+		lastCheck = now
+		if !ok {
+			continue
+		}
+
+		a.runScheduledAction(target, targetOptions, action)
+	}
+}
+
+func (a *AWSProvider) runScheduledAction(target *models.Target, targetOptions *types.TargetOptions, action schedule.Action) {
+	logWriter, cleanupFunc := a.getTargetLogWriter(target.Id, target.Name)
+	defer cleanupFunc()
+
+	switch action {
+	case schedule.ActionStart:
+		logWriter.Write([]byte("Starting target on schedule\n"))
+
+		err := awsutil.StartTarget(target, targetOptions, logWriter)
+		if err != nil {
+			logWriter.Write([]byte("Failed to start target on schedule: " + err.Error() + "\n"))
+			return
+		}
+
+		err = a.waitForDial(target.Id, 10*time.Minute)
+		if err != nil {
+			logWriter.Write([]byte("Failed to dial: " + err.Error() + "\n"))
+			return
+		}
+
+		a.startAutoStop(target, targetOptions)
+	case schedule.ActionStop:
+		logWriter.Write([]byte("Stopping target on schedule\n"))
+
+		a.stopAutoStop(target.Id)
+
+		err := awsutil.StopTarget(target, targetOptions, logWriter)
+		if errors.Is(err, awsutil.ErrInstanceNotFound) {
+			logWriter.Write([]byte("Target instance no longer exists, nothing to stop\n"))
+			return
+		}
+		if err != nil {
+			logWriter.Write([]byte("Failed to stop target on schedule: " + err.Error() + "\n"))
+			return
+		}
+	}
+}
+
+// getNextScheduledActions returns the times of the next start and stop of the
+// schedule of a target, or the zero time if there is none.
+func getNextScheduledActions(targetOptions *types.TargetOptions, now time.Time) (nextStart time.Time, nextStop time.Time) {
+	targetSchedule, err := targetOptions.GetSchedule()
+	if err != nil || targetSchedule == nil {
+		return time.Time{}, time.Time{}
+	}
+
+	return targetSchedule.NextStart(now), targetSchedule.NextStop(now)
+}
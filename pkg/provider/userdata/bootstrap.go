@@ -0,0 +1,93 @@
+package userdata
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"path"
+	"strings"
+	"text/template"
+)
+
+//go:embed bootstrap.sh.tmpl
+var bootstrapTemplateContent string
+
+var bootstrapTemplate = template.Must(template.New("bootstrap").Funcs(template.FuncMap{
+	"base64": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"dir": path.Dir,
+}).Parse(bootstrapTemplateContent))
+
+// Bootstrap is the data of the bootstrap script that prepares an instance and
+// starts the Daytona agent.
+type Bootstrap struct {
+	// User is the user running the agent and owning the workspaces
+	User    string
+	HomeDir string
+	// DockerHost is the address the Docker daemon listens on, next to its unix socket
+	DockerHost string
+	// EnvFilePath is the path of the env file of the agent on the instance
+	EnvFilePath string
+	// EnvFile is the content of the env file, see RenderEnvFile. It is embedded
+	// in the script unless SecretsParameter is set.
+	EnvFile string
+	// SecretsParameter is the SSM parameter the env file is fetched from
+	SecretsParameter *SecretsParameter
+	// InitScript installs the Daytona agent
+	InitScript string
+	// DataVolume is the volume holding the Docker data root and the target dir
+	DataVolume *DataVolume
+}
+
+// SecretsParameter is an SSM parameter holding the env file of a target.
+type SecretsParameter struct {
+	Name   string
+	Region string
+}
+
+// DataVolume is an EBS volume mounted at MountPath, with TargetDir bind
+// mounted from it.
+type DataVolume struct {
+	VolumeId string
+	// Devices are the paths the volume may show up as, depending on the instance type
+	Devices   []string
+	MountPath string
+	TargetDir string
+}
+
+// NewDataVolume returns the data volume with the given id, attached as deviceName.
+func NewDataVolume(volumeId, deviceName, mountPath, targetDir string) *DataVolume {
+	return &DataVolume{
+		VolumeId: volumeId,
+		Devices: []string{
+			"/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_" + strings.ReplaceAll(volumeId, "-", ""),
+			deviceName,
+			strings.Replace(deviceName, "/dev/sd", "/dev/xvd", 1),
+		},
+		MountPath: mountPath,
+		TargetDir: targetDir,
+	}
+}
+
+// NewBootstrap returns the bootstrap with the defaults of the provider.
+func NewBootstrap(envFile, initScript string) *Bootstrap {
+	return &Bootstrap{
+		User:        "daytona",
+		HomeDir:     "/home/daytona",
+		DockerHost:  "tcp://127.0.0.1:2375",
+		EnvFilePath: EnvFilePath,
+		EnvFile:     envFile,
+		InitScript:  initScript,
+	}
+}
+
+// Script renders the bootstrap script.
+func (b *Bootstrap) Script() (string, error) {
+	var script strings.Builder
+	err := bootstrapTemplate.Execute(&script, b)
+	if err != nil {
+		return "", err
+	}
+
+	return script.String(), nil
+}
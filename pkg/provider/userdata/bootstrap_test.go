@@ -0,0 +1,90 @@
+package userdata
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testInitScript = `curl -sfL -H "Authorization: Bearer $DAYTONA_SERVER_API_KEY" https://download.daytona.io/get-agent.sh | bash`
+
+func TestBootstrapScript(t *testing.T) {
+	envFile, err := RenderEnvFile(map[string]string{"SPACES": "a value with spaces"})
+	if err != nil {
+		t.Fatalf("Error rendering env file: %v", err)
+	}
+
+	bootstrap := NewBootstrap(envFile, testInitScript)
+	script, err := bootstrap.Script()
+	if err != nil {
+		t.Fatalf("Error rendering bootstrap script: %v", err)
+	}
+	assertGolden(t, "bootstrap_user_data", script)
+	assertBashSyntax(t, script)
+
+	bootstrap.SecretsParameter = &SecretsParameter{
+		Name:   "/daytona/targets/target1/env",
+		Region: "eu-central-1",
+	}
+	script, err = bootstrap.Script()
+	if err != nil {
+		t.Fatalf("Error rendering bootstrap script: %v", err)
+	}
+	if strings.Contains(script, "SPACES") {
+		t.Errorf("Expected env file not to be embedded with a secrets parameter")
+	}
+	assertGolden(t, "bootstrap_ssm_parameter", script)
+	assertBashSyntax(t, script)
+
+	bootstrap.DataVolume = NewDataVolume("vol-0123456789abcdef0", "/dev/sdf", "/data", "/home/daytona/target1")
+	script, err = bootstrap.Script()
+	if err != nil {
+		t.Fatalf("Error rendering bootstrap script: %v", err)
+	}
+	assertGolden(t, "bootstrap_data_volume", script)
+	assertBashSyntax(t, script)
+}
+
+func TestRender(t *testing.T) {
+	fragments, err := LoadFragments(filepath.Join("testdata", "fragments"))
+	if err != nil {
+		t.Fatalf("Error loading fragments: %v", err)
+	}
+
+	if len(fragments) != 2 {
+		t.Fatalf("Expected 2 fragments but got %d", len(fragments))
+	}
+	if fragments[0].ContentType != "text/cloud-config" || fragments[1].ContentType != "text/x-shellscript" {
+		t.Errorf("Unexpected fragment content types %s and %s", fragments[0].ContentType, fragments[1].ContentType)
+	}
+
+	userData, err := Render(NewBootstrap("", testInitScript), fragments)
+	if err != nil {
+		t.Fatalf("Error rendering user data: %v", err)
+	}
+	assertGolden(t, "multipart", userData)
+}
+
+func TestNewFragmentUnsupported(t *testing.T) {
+	_, err := NewFragment("notes.txt", "install jq")
+	if err == nil {
+		t.Errorf("Expected error for unsupported fragment but got nil")
+	}
+}
+
+func assertBashSyntax(t *testing.T, script string) {
+	t.Helper()
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		return
+	}
+
+	cmd := exec.Command(bash, "-n")
+	cmd.Stdin = strings.NewReader(script)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Errorf("Invalid bash script: %v: %s", err, out)
+	}
+}
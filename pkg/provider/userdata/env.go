@@ -0,0 +1,65 @@
+package userdata
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// EnvFilePath is the path of the file holding the target env vars on the instance
+const EnvFilePath = "/etc/daytona/target.env"
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// envValueReplacer escapes the characters that keep their special meaning
+// inside double quotes. Bash and systemd EnvironmentFile parsing agree on
+// these, so the same line is valid for both.
+var envValueReplacer = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	`$`, `\$`,
+	"`", "\\`",
+)
+
+// ValidateEnvName returns an error if name is not a valid env var name.
+func ValidateEnvName(name string) error {
+	if !envNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid env var name: %q", name)
+	}
+	return nil
+}
+
+// QuoteEnvValue returns the value double quoted and escaped for bash and
+// systemd. Newlines are kept as is, both support them inside double quotes.
+func QuoteEnvValue(value string) (string, error) {
+	if strings.ContainsRune(value, 0) {
+		return "", fmt.Errorf("env var value contains a NUL character")
+	}
+	return `"` + envValueReplacer.Replace(value) + `"`, nil
+}
+
+// RenderEnvFile renders the env vars, sorted by name, as an environment file
+// that can both be sourced by bash and used as a systemd EnvironmentFile.
+func RenderEnvFile(envVars map[string]string) (string, error) {
+	names := make([]string, 0, len(envVars))
+	for name := range envVars {
+		err := ValidateEnvName(name)
+		if err != nil {
+			return "", err
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var envFile strings.Builder
+	for _, name := range names {
+		value, err := QuoteEnvValue(envVars[name])
+		if err != nil {
+			return "", fmt.Errorf("invalid value of env var %s: %w", name, err)
+		}
+		envFile.WriteString(fmt.Sprintf("%s=%s\n", name, value))
+	}
+
+	return envFile.String(), nil
+}
@@ -0,0 +1,104 @@
+package userdata
+
+import (
+	"flag"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+var testEnvVars = map[string]string{
+	"DAYTONA_SERVER_API_KEY": "key",
+	"SPACES":                 "a value with spaces",
+	"QUOTES":                 `single ' and double " quotes`,
+	"EXPANSION":              "$HOME ${PATH} $(id) `id`",
+	"BACKSLASHES":            `C:\path\n \\ \$`,
+	"MULTILINE":              "first line\nsecond line\n",
+	"INJECTION":              "\"; rm -rf / #",
+	"EMPTY":                  "",
+	"_UNDERSCORE":            "_",
+}
+
+func assertGolden(t *testing.T, name, got string) {
+	t.Helper()
+
+	goldenPath := filepath.Join("testdata", name+".golden")
+	if *update {
+		err := os.WriteFile(goldenPath, []byte(got), 0644)
+		if err != nil {
+			t.Fatalf("Error updating golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(goldenPath)
+	if err != nil {
+		t.Fatalf("Error reading golden file: %v", err)
+	}
+
+	if got != string(want) {
+		t.Errorf("%s does not match golden file %s:\n%s", name, goldenPath, got)
+	}
+}
+
+func TestRenderEnvFile(t *testing.T) {
+	envFile, err := RenderEnvFile(testEnvVars)
+	if err != nil {
+		t.Fatalf("Error rendering env file: %v", err)
+	}
+
+	assertGolden(t, "env_file", envFile)
+}
+
+func TestRenderEnvFileInvalid(t *testing.T) {
+	tests := map[string]map[string]string{
+		"empty name":        {"": "value"},
+		"name with digit":   {"1NAME": "value"},
+		"name with space":   {"A NAME": "value"},
+		"name with equals":  {"A=B": "value"},
+		"name with command": {"A;id": "value"},
+		"value with NUL":    {"NAME": "a\x00b"},
+	}
+
+	for name, envVars := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := RenderEnvFile(envVars)
+			if err == nil {
+				t.Errorf("Expected error rendering env file but got nil")
+			}
+		})
+	}
+}
+
+// TestRenderEnvFileBash checks that bash reads back the exact values.
+func TestRenderEnvFileBash(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not found")
+	}
+
+	envFile, err := RenderEnvFile(testEnvVars)
+	if err != nil {
+		t.Fatalf("Error rendering env file: %v", err)
+	}
+
+	envFilePath := filepath.Join(t.TempDir(), "target.env")
+	err = os.WriteFile(envFilePath, []byte(envFile), 0600)
+	if err != nil {
+		t.Fatalf("Error writing env file: %v", err)
+	}
+
+	for name, want := range testEnvVars {
+		cmd := exec.Command(bash, "-c", `set -a; . "$0"; set +a; printf '%s' "${!1}"`, envFilePath, name)
+		cmd.Env = []string{}
+		got, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("Error sourcing env file: %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+}
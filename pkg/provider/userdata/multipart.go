@@ -0,0 +1,151 @@
+package userdata
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// boundary separates the parts of the user data. It is fixed so that the same
+// inputs always render the same user data.
+const boundary = "==DAYTONA-USER-DATA-BOUNDARY=="
+
+// fragmentContentTypes maps the first line prefix of a fragment to its
+// cloud-init content type.
+// https://cloudinit.readthedocs.io/en/latest/explanation/format.html
+var fragmentContentTypes = []struct {
+	prefix      string
+	contentType string
+}{
+	{"#cloud-config", "text/cloud-config"},
+	{"#cloud-boothook", "text/cloud-boothook"},
+	{"#include", "text/x-include-url"},
+	{"#!", "text/x-shellscript"},
+}
+
+// Fragment is a part of the user data, either a script or a cloud-config.
+type Fragment struct {
+	Name        string
+	ContentType string
+	Content     string
+}
+
+// NewFragment returns a fragment with the content type detected from the first
+// line of its content.
+func NewFragment(name, content string) (*Fragment, error) {
+	for _, t := range fragmentContentTypes {
+		if strings.HasPrefix(content, t.prefix) {
+			return &Fragment{
+				Name:        name,
+				ContentType: t.contentType,
+				Content:     content,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported user data fragment %s: it must start with #!, #cloud-config, #cloud-boothook or #include", name)
+}
+
+// LoadFragments loads the fragments from a file, or from the files of a
+// directory in lexical order. Hidden files are skipped.
+func LoadFragments(fragmentsPath string) ([]*Fragment, error) {
+	if fragmentsPath == "" {
+		return nil, nil
+	}
+
+	info, err := os.Stat(fragmentsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read additional user data: %w", err)
+	}
+
+	paths := []string{fragmentsPath}
+	if info.IsDir() {
+		entries, err := os.ReadDir(fragmentsPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read additional user data: %w", err)
+		}
+
+		paths = nil
+		for _, entry := range entries {
+			if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+				continue
+			}
+			paths = append(paths, filepath.Join(fragmentsPath, entry.Name()))
+		}
+		sort.Strings(paths)
+	}
+
+	var fragments []*Fragment
+	for _, p := range paths {
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read additional user data: %w", err)
+		}
+
+		fragment, err := NewFragment(filepath.Base(p), string(content))
+		if err != nil {
+			return nil, err
+		}
+		fragments = append(fragments, fragment)
+	}
+
+	return fragments, nil
+}
+
+// Render renders the bootstrap script followed by the fragments as a MIME
+// multipart cloud-init document. Shell scripts are run by cloud-init in the
+// order of the parts, so the fragments run once the agent is started.
+func Render(bootstrap *Bootstrap, fragments []*Fragment) (string, error) {
+	script, err := bootstrap.Script()
+	if err != nil {
+		return "", err
+	}
+
+	parts := append([]*Fragment{
+		{
+			Name:        "daytona-bootstrap.sh",
+			ContentType: "text/x-shellscript",
+			Content:     script,
+		},
+	}, fragments...)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	err = writer.SetBoundary(boundary)
+	if err != nil {
+		return "", err
+	}
+
+	for _, part := range parts {
+		if strings.Contains(part.Content, boundary) {
+			return "", fmt.Errorf("user data fragment %s contains the multipart boundary", part.Name)
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", fmt.Sprintf("%s; charset=\"utf-8\"", part.ContentType))
+		header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", part.Name))
+		header.Set("Mime-Version", "1.0")
+
+		partWriter, err := writer.CreatePart(header)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = partWriter.Write([]byte(part.Content))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Content-Type: multipart/mixed; boundary=%q\r\nMime-Version: 1.0\r\n\r\n%s", boundary, body.String()), nil
+}
@@ -0,0 +1,89 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+// resolveImage resolves the configured image to an AMI available in the region.
+// The image can be referenced by its AMI id, by an SSM parameter holding the
+// AMI id (resolve:ssm:<parameter path>) or by an owner and a name pattern
+// (<owner>:<name pattern>), in which case the most recent matching AMI is used.
+func resolveImage(sess *session.Session, opts *types.TargetOptions) (*ec2.Image, error) {
+	client := ec2.New(sess)
+	imageRef := strings.TrimSpace(opts.ImageId)
+
+	switch {
+	case strings.HasPrefix(imageRef, types.ImageIdSsmPrefix):
+		parameterName := strings.TrimPrefix(imageRef, types.ImageIdSsmPrefix)
+		result, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+			Name: aws.String(parameterName),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve image from SSM parameter %s: %w", parameterName, err)
+		}
+
+		return getImageById(client, aws.StringValue(result.Parameter.Value), opts.Region)
+	case strings.HasPrefix(imageRef, "ami-"):
+		return getImageById(client, imageRef, opts.Region)
+	default:
+		owner, namePattern, ok := strings.Cut(imageRef, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid image id: %s", imageRef)
+		}
+
+		return getLatestImageByName(client, owner, namePattern, opts.Region)
+	}
+}
+
+func getImageById(client *ec2.EC2, imageId, region string) (*ec2.Image, error) {
+	result, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageId)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find image %s in region %s: %w", imageId, region, err)
+	}
+
+	if len(result.Images) == 0 {
+		return nil, fmt.Errorf("image %s not found in region %s", imageId, region)
+	}
+
+	return result.Images[0], nil
+}
+
+func getLatestImageByName(client *ec2.EC2, owner, namePattern, region string) (*ec2.Image, error) {
+	result, err := client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: []*string{aws.String(owner)},
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("name"),
+				Values: []*string{aws.String(namePattern)},
+			},
+			{
+				Name:   aws.String("state"),
+				Values: []*string{aws.String(ec2.ImageStateAvailable)},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find images of %s matching %s in region %s: %w", owner, namePattern, region, err)
+	}
+
+	if len(result.Images) == 0 {
+		return nil, fmt.Errorf("no images of %s matching %s found in region %s", owner, namePattern, region)
+	}
+
+	// Creation dates are ISO 8601 timestamps, so they sort lexicographically
+	sort.Slice(result.Images, func(i, j int) bool {
+		return aws.StringValue(result.Images[i].CreationDate) > aws.StringValue(result.Images[j].CreationDate)
+	})
+
+	return result.Images[0], nil
+}
@@ -2,18 +2,67 @@ package util
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"path"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials"
-	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/provider/userdata"
 	"github.com/daytonaio/daytona-provider-aws/pkg/types"
 	"github.com/daytonaio/daytona/pkg/models"
+	log "github.com/sirupsen/logrus"
 )
 
-func CreateTarget(target *models.Target, opts *types.TargetOptions, initScript string) error {
-	client, err := getEC2Client(opts)
+var (
+	// ErrInstanceNotFound is returned if a target has no instance, e.g. because
+	// it was terminated outside of Daytona
+	ErrInstanceNotFound = errors.New("instance not found")
+	// ErrMultipleInstances is returned if a target has more than one instance
+	ErrMultipleInstances = errors.New("multiple instances found")
+)
+
+func CreateTarget(target *models.Target, opts *types.TargetOptions, initScript string, logWriter io.Writer) error {
+	sess, err := getSession(opts, target.Id)
+	if err != nil {
+		return err
+	}
+	client := ec2.New(sess)
+
+	// A create that is retried after its instance was launched waits for that
+	// instance instead of launching another one
+	instance, err := getLaunchedInstance(client, target.Id)
+	if err != nil {
+		return err
+	}
+	if instance != nil {
+		logWriter.Write([]byte(fmt.Sprintf("Instance %s of the target is already launched, waiting for it\n", *instance.InstanceId)))
+		return waitForLaunchedInstance(client, opts, target.Id, instance)
+	}
+
+	image, err := resolveImage(sess, opts)
+	if err != nil {
+		return err
+	}
+
+	// A KMS key that cannot be used would only fail the launch, after the
+	// resources of the target are created
+	warning, err := checkKmsKey(sess, opts)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		logWriter.Write([]byte("Warning: " + warning + "\n"))
+	}
+
+	subnets, err := getSubnets(client, opts)
+	if err != nil {
+		return err
+	}
+
+	err = validateSecurityGroups(client, opts, subnets)
 	if err != nil {
 		return err
 	}
@@ -21,75 +70,138 @@ func CreateTarget(target *models.Target, opts *types.TargetOptions, initScript s
 	envVars := target.EnvVars
 	envVars["DAYTONA_AGENT_LOG_FILE_PATH"] = "/home/daytona/.daytona-agent.log"
 
-	userData := `#!/bin/bash
-useradd -m -d /home/daytona daytona
+	envFile, err := userdata.RenderEnvFile(envVars)
+	if err != nil {
+		return err
+	}
+
+	bootstrap := userdata.NewBootstrap(envFile, initScript)
+
+	var dataVolume *ec2.Volume
+	if opts.DataVolumeSize > 0 {
+		dataVolume, err = ensureDataVolume(client, opts, target.Id, subnets)
+		if err != nil {
+			return err
+		}
+		bootstrap.DataVolume = userdata.NewDataVolume(*dataVolume.VolumeId, dataVolumeDeviceName, opts.DataVolumeMountPath, path.Join(bootstrap.HomeDir, target.Id))
+	}
+
+	// The env vars hold secrets such as the target API key, so they are kept out
+	// of the user data unless configured otherwise
+	if opts.SecretsStore != types.SecretsStoreUserData {
+		err = storeTargetSecrets(sess, target.Id, envFile)
+		if err != nil {
+			return err
+		}
+		bootstrap.SecretsParameter = &userdata.SecretsParameter{
+			Name:   getSecretsParameterName(target.Id),
+			Region: opts.Region,
+		}
+	}
+
+	fragments, err := userdata.LoadFragments(opts.AdditionalUserData)
+	if err != nil {
+		return err
+	}
+
+	userData, err := userdata.Render(bootstrap, fragments)
+	if err != nil {
+		return err
+	}
+
+	userData, err = prepareUserData(sess, opts, target.Id, userData, logWriter)
+	if err != nil {
+		return err
+	}
+
+	input := getRunInstancesInput(target.Id, opts, image, userData)
+
+	if opts.StopBehavior == types.StopBehaviorHibernate {
+		err = enableHibernation(client, input, opts, image, logWriter)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The instance must be in the availability zone of its data volume
+	if dataVolume != nil {
+		subnets, err = placeInAvailabilityZone(input, subnets, *dataVolume.AvailabilityZone)
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.SecretsStore != types.SecretsStoreUserData {
+		instanceProfileName, err := createTargetInstanceProfile(sess, opts, target.Id)
+		if err != nil {
+			return err
+		}
+		input.IamInstanceProfile = &ec2.IamInstanceProfileSpecification{
+			Name: aws.String(instanceProfileName),
+		}
+	}
+
+	generation, err := getLaunchGeneration(client, target.Id, dataVolume)
+	if err != nil {
+		return err
+	}
 
-curl -fsSL https://get.docker.com | bash
+	instance, err = launchTargetInstance(client, input, opts, subnets, target.Id, generation, logWriter)
+	if err != nil {
+		return err
+	}
 
-# Modify Docker daemon configuration
-cat > /etc/docker/daemon.json <<EOF
-{
-  "hosts": ["unix:///var/run/docker.sock", "tcp://0.0.0.0:2375"]
+	return waitForLaunchedInstance(client, opts, target.Id, instance)
 }
-EOF
-
-# Create a systemd drop-in file to modify the Docker service
-mkdir -p /etc/systemd/system/docker.service.d
-cat > /etc/systemd/system/docker.service.d/override.conf <<EOF
-[Service]
-ExecStart=
-ExecStart=/usr/bin/dockerd
-EOF
-
-systemctl daemon-reload
-systemctl restart docker
-systemctl start docker
-
-usermod -aG docker daytona
-
-if grep -q sudo /etc/group; then
-	usermod -aG sudo,docker daytona
-elif grep -q wheel /etc/group; then
-	usermod -aG wheel,docker daytona
-fi
-
-echo "daytona ALL=(ALL) NOPASSWD:ALL" > /etc/sudoers.d/91-daytona
-
-`
-
-	for k, v := range envVars {
-		userData += fmt.Sprintf("export %s=%s\n", k, v)
-	}
-	userData += initScript
-	userData += `
-echo '[Unit]
-Description=Daytona Agent Service
-After=network.target
-
-[Service]
-User=daytona
-ExecStart=/usr/local/bin/daytona agent --target
-Restart=always
-`
-
-	for k, v := range envVars {
-		userData += fmt.Sprintf("Environment='%s=%s'\n", k, v)
-	}
-
-	userData += `
-[Install]
-WantedBy=multi-user.target' > /etc/systemd/system/daytona-agent.service
-systemctl daemon-reload
-systemctl enable daytona-agent.service
-systemctl start daytona-agent.service
-`
-
-	result, err := client.RunInstances(&ec2.RunInstancesInput{
-		ImageId:      aws.String(opts.ImageId),
-		InstanceType: aws.String(opts.InstanceType),
-		MinCount:     aws.Int64(1),
-		MaxCount:     aws.Int64(1),
-		UserData:     aws.String(base64.StdEncoding.EncodeToString([]byte(userData))),
+
+// waitForLaunchedInstance waits until the launched instance of a target is
+// running, and sets its expiry and attaches the data volume of the target to
+// it, if not already.
+func waitForLaunchedInstance(client *ec2.EC2, opts *types.TargetOptions, targetId string, instance *ec2.Instance) error {
+	err := client.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{instance.InstanceId},
+	})
+	if err != nil {
+		return err
+	}
+
+	err = ensureExpiry(client, instance, opts)
+	if err != nil {
+		return err
+	}
+
+	if opts.DataVolumeSize == 0 {
+		return nil
+	}
+
+	dataVolume, err := getDataVolume(client, targetId)
+	if err != nil {
+		return err
+	}
+	if dataVolume == nil {
+		return fmt.Errorf("data volume of target %s not found", targetId)
+	}
+
+	err = attachDataVolume(client, dataVolume, instance.InstanceId)
+	if err != nil {
+		return err
+	}
+
+	return recordLaunchGeneration(client, dataVolume, instance)
+}
+
+// getRunInstancesInput builds the input to launch the instance of a target.
+// Network options are set by runInstances.
+func getRunInstancesInput(targetId string, opts *types.TargetOptions, image *ec2.Image, userData string) *ec2.RunInstancesInput {
+	encrypted, kmsKeyId := getEbsEncryption(opts)
+
+	return &ec2.RunInstancesInput{
+		ImageId:               image.ImageId,
+		InstanceType:          aws.String(opts.InstanceType),
+		MinCount:              aws.Int64(1),
+		MaxCount:              aws.Int64(1),
+		UserData:              aws.String(base64.StdEncoding.EncodeToString([]byte(userData))),
+		InstanceMarketOptions: getInstanceMarketOptions(opts),
 		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
 			{
 				DeviceName: aws.String(opts.DeviceName),
@@ -97,6 +209,10 @@ systemctl start daytona-agent.service
 					VolumeSize:          aws.Int64(int64(opts.VolumeSize)),
 					VolumeType:          aws.String(opts.VolumeType),
 					DeleteOnTermination: aws.Bool(true),
+					Encrypted:           encrypted,
+					KmsKeyId:            kmsKeyId,
+					Iops:                getOptionalInt64(opts.Iops),
+					Throughput:          getOptionalInt64(opts.Throughput),
 				},
 			},
 		},
@@ -106,37 +222,88 @@ systemctl start daytona-agent.service
 				Tags: []*ec2.Tag{
 					{
 						Key:   aws.String("Name"),
-						Value: aws.String(fmt.Sprintf("daytona-%s", target.Id)),
+						Value: aws.String(fmt.Sprintf("daytona-%s", targetId)),
 					},
 					{
 						Key:   aws.String("WorkspaceID"),
-						Value: aws.String(target.Id),
+						Value: aws.String(targetId),
+					},
+					{
+						Key:   aws.String("ImageId"),
+						Value: image.ImageId,
+					},
+					{
+						Key:   aws.String("ImageName"),
+						Value: aws.String(aws.StringValue(image.Name)),
 					},
 				},
 			},
 		},
-	})
+	}
+}
+
+func StartTarget(target *models.Target, opts *types.TargetOptions, logWriter io.Writer) error {
+	client, err := getEC2Client(opts, target.Id)
 	if err != nil {
 		return err
 	}
 
-	return client.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
-		InstanceIds: []*string{result.Instances[0].InstanceId},
-	})
-}
+	instance, err := getInstanceByWorkspaceID(client, target.Id)
+	if err != nil {
+		return err
+	}
 
-func StartTarget(target *models.Target, opts *types.TargetOptions) error {
-	client, err := getEC2Client(opts)
+	err = checkExpiry(instance)
 	if err != nil {
 		return err
 	}
 
-	instance, err := getInstanceByWorkspaceID(client, target.Id)
+	// The instance type of the target options was changed since the instance
+	// was launched. If the instance does not support the change, it is started
+	// with its current type, so the target stays usable.
+	if needsResize(instance, opts) {
+		err = resizeInstance(client, instance, opts, logWriter)
+		switch {
+		case errors.Is(err, ErrUnsupportedInstanceTypeChange):
+			logWriter.Write([]byte(fmt.Sprintf("Skipping instance type change, starting the instance as %s: %s\n", *instance.InstanceType, err.Error())))
+		case err != nil:
+			return err
+		default:
+			instance.State.Name = aws.String(ec2.InstanceStateNameStopped)
+		}
+	}
+
+	switch *instance.State.Name {
+	case ec2.InstanceStateNameRunning:
+		return nil
+	case ec2.InstanceStateNamePending:
+		return client.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{instance.InstanceId},
+		})
+	case ec2.InstanceStateNameStopping:
+		err = client.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{instance.InstanceId},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	spotStatus, err := getSpotRequestStatus(client, instance)
 	if err != nil {
 		return err
 	}
 
-	if instance.State.String() == "running" {
+	// Only the spot service can start an instance that was stopped by a spot
+	// interruption, which it does once capacity is available again.
+	if spotStoppedStatusCodes[spotStatus] {
+		logWriter.Write([]byte(fmt.Sprintf("Spot instance was stopped by AWS (%s), waiting for capacity to restart it\n", spotStatus)))
+		err = client.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{instance.InstanceId},
+		})
+		if err != nil {
+			return fmt.Errorf("spot instance was not restarted by AWS, capacity is not available yet: %w", err)
+		}
 		return nil
 	}
 
@@ -152,8 +319,8 @@ func StartTarget(target *models.Target, opts *types.TargetOptions) error {
 	})
 }
 
-func StopTarget(target *models.Target, opts *types.TargetOptions) error {
-	client, err := getEC2Client(opts)
+func StopTarget(target *models.Target, opts *types.TargetOptions, logWriter io.Writer) error {
+	client, err := getEC2Client(opts, target.Id)
 	if err != nil {
 		return err
 	}
@@ -163,9 +330,11 @@ func StopTarget(target *models.Target, opts *types.TargetOptions) error {
 		return err
 	}
 
-	_, err = client.StopInstances(&ec2.StopInstancesInput{
-		InstanceIds: []*string{instance.InstanceId},
-	})
+	if *instance.State.Name == ec2.InstanceStateNameStopped {
+		return nil
+	}
+
+	err = stopInstance(client, instance, opts, logWriter)
 	if err != nil {
 		return err
 	}
@@ -175,25 +344,84 @@ func StopTarget(target *models.Target, opts *types.TargetOptions) error {
 	})
 }
 
+// DeleteTarget terminates all instances of the target and deletes its other
+// resources. Deleting a target whose instance no longer exists succeeds.
+// The data volume is kept if its deletion policy is retain.
 func DeleteTarget(target *models.Target, opts *types.TargetOptions) error {
-	client, err := getEC2Client(opts)
+	return deleteTarget(target, opts, opts.DataVolumeDeletionPolicy != types.DeletionPolicyRetain)
+}
+
+func deleteTarget(target *models.Target, opts *types.TargetOptions, withDataVolume bool) error {
+	sess, err := getSession(opts, target.Id)
 	if err != nil {
 		return err
 	}
+	client := ec2.New(sess)
 
-	instance, err := getInstanceByWorkspaceID(client, target.Id)
+	instances, err := listInstancesByWorkspaceID(client, target.Id)
 	if err != nil {
 		return err
 	}
 
-	_, err = client.TerminateInstances(&ec2.TerminateInstancesInput{
-		InstanceIds: []*string{instance.InstanceId},
+	err = terminateInstances(client, instances)
+	if err != nil {
+		return err
+	}
+
+	// Targets with the secrets in the user data have no parameter or role
+	if opts.SecretsStore != types.SecretsStoreUserData {
+		err = deleteTargetSecrets(sess, target.Id)
+		if isAccessDeniedError(err) {
+			// The instance is already terminated, missing permissions only leave
+			// the parameter and role behind, see CollectOrphans
+			log.Warnf("Failed to delete the secrets of target %s: %s", target.Id, err)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	err = deleteUserData(sess, opts, target.Id)
+	if err != nil {
+		return err
+	}
+
+	if withDataVolume {
+		return deleteDataVolume(client, target.Id)
+	}
+
+	return nil
+}
+
+// terminateInstances terminates the instances and waits until they are
+// terminated, after which the resources they use can be deleted.
+func terminateInstances(client *ec2.EC2, instances []*ec2.Instance) error {
+	if len(instances) == 0 {
+		return nil
+	}
+
+	var instanceIds []*string
+	for _, instance := range instances {
+		err := cancelSpotRequest(client, instance)
+		if err != nil {
+			return err
+		}
+		instanceIds = append(instanceIds, instance.InstanceId)
+	}
+
+	_, err := client.TerminateInstances(&ec2.TerminateInstancesInput{
+		InstanceIds: instanceIds,
+	})
+	if err != nil {
+		return err
+	}
+
+	return client.WaitUntilInstanceTerminated(&ec2.DescribeInstancesInput{
+		InstanceIds: instanceIds,
 	})
-	return err
 }
 
 func GetInstance(target *models.Target, opts *types.TargetOptions) (*ec2.Instance, error) {
-	client, err := getEC2Client(opts)
+	client, err := getEC2Client(opts, target.Id)
 	if err != nil {
 		return nil, err
 	}
@@ -202,15 +430,8 @@ func GetInstance(target *models.Target, opts *types.TargetOptions) (*ec2.Instanc
 }
 
 // getEC2Client  creates a new EC2 client using the provided target options.
-func getEC2Client(opts *types.TargetOptions) (*ec2.EC2, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String(opts.Region),
-		Credentials: credentials.NewStaticCredentials(
-			opts.AccessKeyId,
-			opts.SecretAccessKey,
-			"",
-		),
-	})
+func getEC2Client(opts *types.TargetOptions, targetId string) (*ec2.EC2, error) {
+	sess, err := getSession(opts, targetId)
 	if err != nil {
 		return nil, err
 	}
@@ -218,29 +439,64 @@ func getEC2Client(opts *types.TargetOptions) (*ec2.EC2, error) {
 	return ec2.New(sess), nil
 }
 
-// getInstanceByWorkspaceID retrieves the first running or stopped EC2 instance
-// associated with a given workspace ID.
+// getInstanceByWorkspaceID retrieves the EC2 instance associated with a given
+// workspace ID. It returns ErrInstanceNotFound if no instance exists and
+// ErrMultipleInstances if more than one instance exists.
 func getInstanceByWorkspaceID(svc *ec2.EC2, workspaceID string) (*ec2.Instance, error) {
-	result, err := svc.DescribeInstances(&ec2.DescribeInstancesInput{
+	instances, err := listInstancesByWorkspaceID(svc, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("%w for target %s", ErrInstanceNotFound, workspaceID)
+	}
+
+	if len(instances) > 1 {
+		var instanceIds []string
+		for _, instance := range instances {
+			instanceIds = append(instanceIds, *instance.InstanceId)
+		}
+		return nil, fmt.Errorf("%w for target %s: %s", ErrMultipleInstances, workspaceID, strings.Join(instanceIds, ", "))
+	}
+
+	return instances[0], nil
+}
+
+// listInstancesByWorkspaceID retrieves all EC2 instances associated with a
+// given workspace ID that have not been terminated.
+func listInstancesByWorkspaceID(svc *ec2.EC2, workspaceID string) ([]*ec2.Instance, error) {
+	var instances []*ec2.Instance
+	err := svc.DescribeInstancesPages(&ec2.DescribeInstancesInput{
 		Filters: []*ec2.Filter{
 			{
 				Name:   aws.String("tag:WorkspaceID"),
 				Values: []*string{aws.String(workspaceID)},
 			},
 			{
-				Name:   aws.String("instance-state-name"),
-				Values: []*string{aws.String("running"), aws.String("stopped")},
+				Name: aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{
+					ec2.InstanceStateNamePending,
+					ec2.InstanceStateNameRunning,
+					ec2.InstanceStateNameStopping,
+					ec2.InstanceStateNameStopped,
+				}),
 			},
 		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			instances = append(instances, reservation.Instances...)
+		}
+		return true
 	})
-	if err != nil {
-		return nil, err
-	}
 
-	var instances []*ec2.Instance
-	for _, reservation := range result.Reservations {
-		instances = append(instances, reservation.Instances...)
-	}
+	return instances, err
+}
 
-	return instances[0], nil
+// getOptionalInt64 returns nil for zero values, which are not set in requests.
+func getOptionalInt64(value int) *int64 {
+	if value == 0 {
+		return nil
+	}
+	return aws.Int64(int64(value))
 }
@@ -0,0 +1,239 @@
+package util
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+const (
+	// VolumeTagKey identifies the data volume of a target among its volumes
+	VolumeTagKey   = "DaytonaVolume"
+	VolumeTagValue = "data"
+	// DeletionPolicyTagKey records the deletion policy of the data volume, so
+	// that retained volumes are kept once their target is destroyed
+	DeletionPolicyTagKey = "DaytonaDeletionPolicy"
+
+	// dataVolumeDeviceName is the device name the data volume is attached as.
+	// On Nitro instances, the volume shows up as an NVMe device instead, see
+	// the bootstrap script.
+	dataVolumeDeviceName = "/dev/sdf"
+)
+
+// getDataVolume retrieves the data volume of a target, or nil if the target
+// has none.
+func getDataVolume(client *ec2.EC2, targetId string) (*ec2.Volume, error) {
+	result, err := client.DescribeVolumes(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:WorkspaceID"),
+				Values: []*string{aws.String(targetId)},
+			},
+			{
+				Name:   aws.String("tag:" + VolumeTagKey),
+				Values: []*string{aws.String(VolumeTagValue)},
+			},
+			{
+				Name: aws.String("status"),
+				Values: aws.StringSlice([]string{
+					ec2.VolumeStateCreating,
+					ec2.VolumeStateAvailable,
+					ec2.VolumeStateInUse,
+				}),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Volumes) == 0 {
+		return nil, nil
+	}
+
+	if len(result.Volumes) > 1 {
+		return nil, fmt.Errorf("target %s has %d data volumes, expected one", targetId, len(result.Volumes))
+	}
+
+	return result.Volumes[0], nil
+}
+
+// ensureDataVolume returns the data volume of a target, creating it if the
+// target has none yet. An existing volume is reused, so its data survives the
+// replacement of the instance.
+func ensureDataVolume(client *ec2.EC2, opts *types.TargetOptions, targetId string, subnets []*ec2.Subnet) (*ec2.Volume, error) {
+	volume, err := getDataVolume(client, targetId)
+	if err != nil || volume != nil {
+		return volume, err
+	}
+
+	availabilityZone, err := getDataVolumeAvailabilityZone(client, opts, subnets)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, kmsKeyId := getEbsEncryption(opts)
+
+	volume, err = client.CreateVolume(&ec2.CreateVolumeInput{
+		AvailabilityZone: aws.String(availabilityZone),
+		Size:             aws.Int64(int64(opts.DataVolumeSize)),
+		VolumeType:       aws.String(opts.DataVolumeType),
+		Iops:             getOptionalInt64(opts.DataVolumeIops),
+		Throughput:       getOptionalInt64(opts.DataVolumeThroughput),
+		Encrypted:        encrypted,
+		KmsKeyId:         kmsKeyId,
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String(ec2.ResourceTypeVolume),
+				Tags: []*ec2.Tag{
+					{
+						Key:   aws.String("Name"),
+						Value: aws.String(fmt.Sprintf("daytona-%s-data", targetId)),
+					},
+					{
+						Key:   aws.String("WorkspaceID"),
+						Value: aws.String(targetId),
+					},
+					{
+						Key:   aws.String(VolumeTagKey),
+						Value: aws.String(VolumeTagValue),
+					},
+					{
+						Key:   aws.String(DeletionPolicyTagKey),
+						Value: aws.String(opts.DataVolumeDeletionPolicy),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create data volume: %w", err)
+	}
+
+	err = client.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{volume.VolumeId},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return volume, nil
+}
+
+// attachDataVolume attaches the data volume to the instance, unless it is
+// already attached to it. The volume is not deleted on termination, see
+// DeleteTarget.
+func attachDataVolume(client *ec2.EC2, volume *ec2.Volume, instanceId *string) error {
+	for _, attachment := range volume.Attachments {
+		if aws.StringValue(attachment.InstanceId) == aws.StringValue(instanceId) {
+			return client.WaitUntilVolumeInUse(&ec2.DescribeVolumesInput{
+				VolumeIds: []*string{volume.VolumeId},
+			})
+		}
+	}
+
+	_, err := client.AttachVolume(&ec2.AttachVolumeInput{
+		VolumeId:   volume.VolumeId,
+		InstanceId: instanceId,
+		Device:     aws.String(dataVolumeDeviceName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to attach data volume %s: %w", *volume.VolumeId, err)
+	}
+
+	return client.WaitUntilVolumeInUse(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{volume.VolumeId},
+	})
+}
+
+// deleteDataVolume deletes the data volume of a target, once it is detached
+// from the terminated instance.
+func deleteDataVolume(client *ec2.EC2, targetId string) error {
+	volume, err := getDataVolume(client, targetId)
+	if err != nil || volume == nil {
+		return err
+	}
+
+	err = client.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{volume.VolumeId},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = client.DeleteVolume(&ec2.DeleteVolumeInput{
+		VolumeId: volume.VolumeId,
+	})
+	return err
+}
+
+// getDataVolumeAvailabilityZone returns the availability zone to create the
+// data volume in: the zone of the first configured subnet that offers the
+// instance type, or the first zone of the region that does.
+func getDataVolumeAvailabilityZone(client *ec2.EC2, opts *types.TargetOptions, subnets []*ec2.Subnet) (string, error) {
+	for _, subnet := range subnets {
+		offered, err := isInstanceTypeOffered(client, opts.InstanceType, ec2.LocationTypeAvailabilityZone, *subnet.AvailabilityZone)
+		if err != nil {
+			return "", err
+		}
+		if offered {
+			return *subnet.AvailabilityZone, nil
+		}
+	}
+
+	if len(subnets) > 0 {
+		return "", fmt.Errorf("instance type %s is not offered in the availability zones of the configured subnets", opts.InstanceType)
+	}
+
+	result, err := client.DescribeInstanceTypeOfferings(&ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(ec2.LocationTypeAvailabilityZone),
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-type"),
+				Values: []*string{aws.String(opts.InstanceType)},
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var availabilityZones []string
+	for _, offering := range result.InstanceTypeOfferings {
+		availabilityZones = append(availabilityZones, *offering.Location)
+	}
+
+	if len(availabilityZones) == 0 {
+		return "", fmt.Errorf("instance type %s is not offered in region %s", opts.InstanceType, opts.Region)
+	}
+
+	sort.Strings(availabilityZones)
+	return availabilityZones[0], nil
+}
+
+// placeInAvailabilityZone restricts the launch of the instance to the
+// availability zone of its data volume.
+func placeInAvailabilityZone(input *ec2.RunInstancesInput, subnets []*ec2.Subnet, availabilityZone string) ([]*ec2.Subnet, error) {
+	if len(subnets) == 0 {
+		input.Placement = &ec2.Placement{
+			AvailabilityZone: aws.String(availabilityZone),
+		}
+		return nil, nil
+	}
+
+	var zoneSubnets []*ec2.Subnet
+	for _, subnet := range subnets {
+		if *subnet.AvailabilityZone == availabilityZone {
+			zoneSubnets = append(zoneSubnets, subnet)
+		}
+	}
+
+	if len(zoneSubnets) == 0 {
+		return nil, fmt.Errorf("the data volume is in availability zone %s, but none of the configured subnets is", availabilityZone)
+	}
+
+	return zoneSubnets, nil
+}
@@ -0,0 +1,128 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+	"github.com/daytonaio/daytona/pkg/provider"
+)
+
+// checkKmsKey checks that the KMS key used to encrypt the volumes exists in
+// the region and can be used to encrypt EBS volumes. It returns a warning if
+// the credentials may not be allowed to use the key.
+func checkKmsKey(sess *session.Session, opts *types.TargetOptions) (string, error) {
+	if opts.KmsKeyId == "" {
+		return "", nil
+	}
+
+	client := kms.New(sess)
+
+	result, err := client.DescribeKey(&kms.DescribeKeyInput{
+		KeyId: aws.String(opts.KmsKeyId),
+	})
+	if err != nil {
+		return "", fmt.Errorf("KMS key %s not found in region %s: %w", opts.KmsKeyId, opts.Region, err)
+	}
+
+	key := result.KeyMetadata
+	if aws.StringValue(key.KeyState) != kms.KeyStateEnabled {
+		return "", fmt.Errorf("KMS key %s is %s", opts.KmsKeyId, aws.StringValue(key.KeyState))
+	}
+
+	// EBS only supports symmetric encryption keys
+	if aws.StringValue(key.KeyUsage) != kms.KeyUsageTypeEncryptDecrypt || aws.StringValue(key.KeySpec) != kms.KeySpecSymmetricDefault {
+		return "", fmt.Errorf("KMS key %s is not a symmetric encryption key", opts.KmsKeyId)
+	}
+
+	// Describing a key does not require the permissions to use it, EBS
+	// generates the data key of a volume with the credentials of the caller.
+	// Key policies with a kms:ViaService condition only allow the call through
+	// EC2, so a failed dry run is not conclusive
+	_, err = client.GenerateDataKeyWithoutPlaintext(&kms.GenerateDataKeyWithoutPlaintextInput{
+		KeyId:   aws.String(opts.KmsKeyId),
+		KeySpec: aws.String(kms.DataKeySpecAes256),
+		DryRun:  aws.Bool(true),
+	})
+	if err != nil && !isAwsErrorCode(err, kms.ErrCodeDryRunOperationException) {
+		return fmt.Sprintf("KMS key %s may not be usable, volumes cannot be encrypted unless the key policy allows it through EC2: %s", opts.KmsKeyId, err), nil
+	}
+
+	return "", nil
+}
+
+// CheckKmsKey checks the KMS key of the target options, e.g. of a preset
+// target config, and reports it as the named requirement.
+func CheckKmsKey(name string, opts *types.TargetOptions) provider.RequirementStatus {
+	sess, err := getSession(opts, "")
+	if err != nil {
+		return getRequirementStatus(name, err)
+	}
+
+	return getKmsKeyRequirementStatus(name, sess, opts)
+}
+
+// getKmsKeyRequirementStatus reports the KMS key check as the named
+// requirement. A warning leaves the requirement met, with the warning as
+// reason.
+func getKmsKeyRequirementStatus(name string, sess *session.Session, opts *types.TargetOptions) provider.RequirementStatus {
+	warning, err := checkKmsKey(sess, opts)
+	status := getRequirementStatus(name, err)
+	if err == nil && warning != "" {
+		status.Reason = warning
+	}
+
+	return status
+}
+
+// getEbsEncryption sets the encryption of a volume launched with the target
+// options. Volumes are left to the EBS encryption by default setting of the
+// account unless encryption is enabled.
+func getEbsEncryption(opts *types.TargetOptions) (encrypted *bool, kmsKeyId *string) {
+	if !opts.EncryptVolume {
+		return nil, nil
+	}
+
+	if opts.KmsKeyId == "" {
+		return aws.Bool(true), nil
+	}
+
+	return aws.Bool(true), aws.String(opts.KmsKeyId)
+}
+
+// GetVolumeEncryption returns the encryption state of the root volume of the
+// instance, and the KMS key it is encrypted with.
+func GetVolumeEncryption(target *models.Target, opts *types.TargetOptions, instance *ec2.Instance) (bool, string, error) {
+	var volumeId *string
+	for _, mapping := range instance.BlockDeviceMappings {
+		if aws.StringValue(mapping.DeviceName) == aws.StringValue(instance.RootDeviceName) && mapping.Ebs != nil {
+			volumeId = mapping.Ebs.VolumeId
+		}
+	}
+
+	if volumeId == nil {
+		return false, "", nil
+	}
+
+	client, err := getEC2Client(opts, target.Id)
+	if err != nil {
+		return false, "", err
+	}
+
+	result, err := client.DescribeVolumes(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{volumeId},
+	})
+	if err != nil {
+		return false, "", err
+	}
+
+	if len(result.Volumes) == 0 {
+		return false, "", nil
+	}
+
+	return aws.BoolValue(result.Volumes[0].Encrypted), aws.StringValue(result.Volumes[0].KmsKeyId), nil
+}
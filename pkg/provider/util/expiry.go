@@ -0,0 +1,138 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+// ExpiryTagKey is the instance tag holding the RFC 3339 time a target expires at.
+// While the instance of a target is recreated, the data volume holds it too.
+const ExpiryTagKey = "DaytonaExpiresAt"
+
+// ErrTargetExpired is returned when starting a target whose TTL has passed
+var ErrTargetExpired = errors.New("target expired")
+
+// ExpiryWarnings are how long before the expiry of a target warnings are logged
+var ExpiryWarnings = []time.Duration{time.Hour, 15 * time.Minute, 5 * time.Minute}
+
+// getExpiryTags returns the expiry tag of an instance launched at launchTime
+// with the target options, if the target has a TTL.
+func getExpiryTags(opts *types.TargetOptions, launchTime time.Time) []*ec2.Tag {
+	ttl := opts.TTLDuration()
+	if ttl == 0 {
+		return nil
+	}
+
+	return []*ec2.Tag{
+		{
+			Key:   aws.String(ExpiryTagKey),
+			Value: aws.String(launchTime.Add(ttl).UTC().Format(time.RFC3339)),
+		},
+	}
+}
+
+// ensureExpiry tags the launched instance with its expiry, unless it already
+// has one. The expiry is set after the launch, from the launch time of the
+// instance, so that the parameters of a retried launch do not change, see
+// launchTargetInstance.
+func ensureExpiry(client *ec2.EC2, instance *ec2.Instance, opts *types.TargetOptions) error {
+	expiresAt, err := GetExpiry(instance)
+	if err != nil || !expiresAt.IsZero() {
+		return err
+	}
+
+	launchTime := time.Now()
+	if instance.LaunchTime != nil {
+		launchTime = *instance.LaunchTime
+	}
+
+	tags := getExpiryTags(opts, launchTime)
+	if tags == nil {
+		return nil
+	}
+
+	_, err = client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{instance.InstanceId},
+		Tags:      tags,
+	})
+	return err
+}
+
+// GetExpiry returns the time the target of the instance expires at, or the
+// zero time if it has no TTL.
+func GetExpiry(instance *ec2.Instance) (time.Time, error) {
+	return getTagsExpiry(instance.Tags, "instance "+aws.StringValue(instance.InstanceId))
+}
+
+// getTagsExpiry returns the expiry in the tags of the described resource, or
+// the zero time if they have none.
+func getTagsExpiry(tags []*ec2.Tag, resourceId string) (time.Time, error) {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) != ExpiryTagKey {
+			continue
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, aws.StringValue(tag.Value))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid %s tag of %s: %w", ExpiryTagKey, resourceId, err)
+		}
+		return expiresAt, nil
+	}
+
+	return time.Time{}, nil
+}
+
+// checkExpiry returns ErrTargetExpired if the target of the instance expired.
+func checkExpiry(instance *ec2.Instance) error {
+	expiresAt, err := GetExpiry(instance)
+	if err != nil {
+		return err
+	}
+
+	return checkExpiresAt(expiresAt, "instance "+*instance.InstanceId)
+}
+
+// checkExpiresAt returns ErrTargetExpired if the expiry, read from the tags of
+// the described resource, passed.
+func checkExpiresAt(expiresAt time.Time, resourceId string) error {
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return fmt.Errorf("%w at %s, update the %s tag of %s to extend its lifetime", ErrTargetExpired, expiresAt.Format(time.RFC3339), ExpiryTagKey, resourceId)
+	}
+
+	return nil
+}
+
+// setExpiry sets the expiry of the target on its instance or data volume, e.g.
+// to keep the expiry of a target whose instance is replaced.
+func setExpiry(client *ec2.EC2, resourceId *string, expiresAt time.Time) error {
+	_, err := client.CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{resourceId},
+		Tags: []*ec2.Tag{
+			{
+				Key:   aws.String(ExpiryTagKey),
+				Value: aws.String(expiresAt.UTC().Format(time.RFC3339)),
+			},
+		},
+	})
+	return err
+}
+
+// DueExpiryWarning returns the warning of ExpiryWarnings that fell due after
+// from, up to and including to. If more than one fell due, the last one is
+// returned.
+func DueExpiryWarning(expiresAt, from, to time.Time) (time.Duration, bool) {
+	var due time.Duration
+	for _, warning := range ExpiryWarnings {
+		warnAt := expiresAt.Add(-warning)
+		if warnAt.After(from) && !warnAt.After(to) && (due == 0 || warning < due) {
+			due = warning
+		}
+	}
+
+	return due, due != 0
+}
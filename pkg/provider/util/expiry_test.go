@@ -0,0 +1,77 @@
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+func TestGetExpiry(t *testing.T) {
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	tags := getExpiryTags(&types.TargetOptions{TTL: "8h"}, now)
+	expiresAt, err := GetExpiry(&ec2.Instance{Tags: tags})
+	if err != nil {
+		t.Fatalf("GetExpiry() error = %v", err)
+	}
+	if !expiresAt.Equal(now.Add(8 * time.Hour)) {
+		t.Errorf("GetExpiry() = %v, want %v", expiresAt, now.Add(8*time.Hour))
+	}
+
+	if tags := getExpiryTags(&types.TargetOptions{}, now); tags != nil {
+		t.Errorf("getExpiryTags() = %v for a target without TTL", tags)
+	}
+
+	expiresAt, err = GetExpiry(&ec2.Instance{})
+	if err != nil || !expiresAt.IsZero() {
+		t.Errorf("GetExpiry() = %v, %v, want the zero time for an instance without expiry", expiresAt, err)
+	}
+
+	_, err = GetExpiry(&ec2.Instance{
+		InstanceId: aws.String("i-0123"),
+		Tags:       []*ec2.Tag{{Key: aws.String(ExpiryTagKey), Value: aws.String("tomorrow")}},
+	})
+	if err == nil {
+		t.Errorf("GetExpiry() expected error for an invalid expiry tag")
+	}
+
+	// A recreated target keeps the expiry copied to its data volume
+	expiresAt, err = getTagsExpiry(tags, "data volume vol-0123")
+	if err != nil || !expiresAt.Equal(now.Add(8*time.Hour)) {
+		t.Errorf("getTagsExpiry() = %v, %v, want %v", expiresAt, err, now.Add(8*time.Hour))
+	}
+	if err = checkExpiresAt(expiresAt, "data volume vol-0123"); !errors.Is(err, ErrTargetExpired) {
+		t.Errorf("checkExpiresAt() error = %v, want ErrTargetExpired", err)
+	}
+}
+
+func TestDueExpiryWarning(t *testing.T) {
+	expiresAt := time.Date(2024, 3, 4, 18, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		from   time.Time
+		to     time.Time
+		want   time.Duration
+		wantOk bool
+	}{
+		{name: "Nothing due", from: expiresAt.Add(-3 * time.Hour), to: expiresAt.Add(-2 * time.Hour)},
+		{name: "One hour", from: expiresAt.Add(-61 * time.Minute), to: expiresAt.Add(-60 * time.Minute), want: time.Hour, wantOk: true},
+		{name: "Already warned", from: expiresAt.Add(-60 * time.Minute), to: expiresAt.Add(-59 * time.Minute)},
+		{name: "Last of several", from: expiresAt.Add(-2 * time.Hour), to: expiresAt.Add(-10 * time.Minute), want: 15 * time.Minute, wantOk: true},
+		{name: "Watch started late", from: time.Time{}, to: expiresAt.Add(-3 * time.Minute), want: 5 * time.Minute, wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := DueExpiryWarning(expiresAt, tt.from, tt.to)
+			if got != tt.want || ok != tt.wantOk {
+				t.Errorf("DueExpiryWarning() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
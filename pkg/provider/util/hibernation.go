@@ -0,0 +1,123 @@
+package util
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+// maxHibernationMemoryMiB is the largest memory size of Linux instances that
+// can be hibernated.
+// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/hibernating-prerequisites.html
+const maxHibernationMemoryMiB = 150 * 1024
+
+// enableHibernation configures the instance to be launched with hibernation
+// enabled. If the instance type or image does not support hibernation, the
+// reason is logged and the instance is launched without it.
+func enableHibernation(client *ec2.EC2, input *ec2.RunInstancesInput, opts *types.TargetOptions, image *ec2.Image, logWriter io.Writer) error {
+	instanceTypeInfo, err := getInstanceTypeInfo(client, opts.InstanceType)
+	if err != nil {
+		return err
+	}
+
+	err = checkHibernationSupport(instanceTypeInfo, image)
+	if err != nil {
+		logWriter.Write([]byte(fmt.Sprintf("Hibernation not available (%s), the instance will be stopped instead\n", err.Error())))
+		return nil
+	}
+
+	// The memory of the instance is saved to the encrypted root volume, next to
+	// the space configured for the OS and the workspaces
+	rootDevice := input.BlockDeviceMappings[0].Ebs
+	rootDevice.Encrypted = aws.Bool(true)
+	rootDevice.VolumeSize = aws.Int64(getHibernationVolumeSize(opts.VolumeSize, *instanceTypeInfo.MemoryInfo.SizeInMiB))
+
+	input.HibernationOptions = &ec2.HibernationOptionsRequest{
+		Configured: aws.Bool(true),
+	}
+
+	return nil
+}
+
+// disableHibernation reverts enableHibernation.
+func disableHibernation(input *ec2.RunInstancesInput, opts *types.TargetOptions) {
+	encrypted, _ := getEbsEncryption(opts)
+
+	rootDevice := input.BlockDeviceMappings[0].Ebs
+	rootDevice.Encrypted = encrypted
+	rootDevice.VolumeSize = aws.Int64(int64(opts.VolumeSize))
+
+	input.HibernationOptions = nil
+}
+
+// checkHibernationSupport returns why instances of the instance type launched
+// from the image cannot be hibernated, or nil if they can. Whether the OS of
+// the image supports hibernation is only known once the instance is launched.
+func checkHibernationSupport(instanceTypeInfo *ec2.InstanceTypeInfo, image *ec2.Image) error {
+	if !aws.BoolValue(instanceTypeInfo.HibernationSupported) {
+		return fmt.Errorf("instance type %s does not support hibernation", *instanceTypeInfo.InstanceType)
+	}
+
+	if instanceTypeInfo.MemoryInfo == nil || aws.Int64Value(instanceTypeInfo.MemoryInfo.SizeInMiB) > maxHibernationMemoryMiB {
+		return fmt.Errorf("instance type %s has more than %d GiB of memory", *instanceTypeInfo.InstanceType, maxHibernationMemoryMiB/1024)
+	}
+
+	if aws.StringValue(image.RootDeviceType) != ec2.DeviceTypeEbs {
+		return fmt.Errorf("image %s is not backed by EBS", *image.ImageId)
+	}
+
+	if aws.StringValue(image.VirtualizationType) != ec2.VirtualizationTypeHvm {
+		return fmt.Errorf("image %s does not use HVM virtualization", *image.ImageId)
+	}
+
+	return nil
+}
+
+// getHibernationVolumeSize returns the size, in GiB, of a root volume that
+// holds the memory of the instance on top of the configured volume size.
+func getHibernationVolumeSize(volumeSize int, memoryMiB int64) int64 {
+	return int64(volumeSize) + (memoryMiB+1023)/1024
+}
+
+// isHibernationConfigured returns true if the instance was launched with
+// hibernation enabled.
+func isHibernationConfigured(instance *ec2.Instance) bool {
+	return instance.HibernationOptions != nil && aws.BoolValue(instance.HibernationOptions.Configured)
+}
+
+// isHibernationConfigurationError returns true if the instance could not be
+// launched because the image does not meet the hibernation prerequisites.
+func isHibernationConfigurationError(err error) bool {
+	return isAwsErrorCode(err, "UnsupportedHibernationConfiguration")
+}
+
+// stopInstance stops the instance, or hibernates it if the target options ask
+// for it. If the instance cannot be hibernated, the reason is logged and the
+// instance is stopped instead.
+func stopInstance(client *ec2.EC2, instance *ec2.Instance, opts *types.TargetOptions, logWriter io.Writer) error {
+	if opts.StopBehavior == types.StopBehaviorHibernate {
+		if !isHibernationConfigured(instance) {
+			logWriter.Write([]byte(fmt.Sprintf("Instance %s was launched without hibernation, stopping it instead\n", *instance.InstanceId)))
+		} else {
+			_, err := client.StopInstances(&ec2.StopInstancesInput{
+				InstanceIds: []*string{instance.InstanceId},
+				Hibernate:   aws.Bool(true),
+			})
+			if err == nil {
+				logWriter.Write([]byte(fmt.Sprintf("Hibernating instance %s\n", *instance.InstanceId)))
+				return nil
+			}
+
+			// e.g. the hibernation agent of the instance is not ready yet
+			logWriter.Write([]byte(fmt.Sprintf("Failed to hibernate instance %s (%s), stopping it instead\n", *instance.InstanceId, err.Error())))
+		}
+	}
+
+	_, err := client.StopInstances(&ec2.StopInstancesInput{
+		InstanceIds: []*string{instance.InstanceId},
+	})
+	return err
+}
@@ -0,0 +1,73 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func TestCheckHibernationSupport(t *testing.T) {
+	image := &ec2.Image{
+		ImageId:            aws.String("ami-12345678"),
+		RootDeviceType:     aws.String(ec2.DeviceTypeEbs),
+		VirtualizationType: aws.String(ec2.VirtualizationTypeHvm),
+	}
+
+	newInstanceTypeInfo := func(hibernationSupported bool, memoryMiB int64) *ec2.InstanceTypeInfo {
+		return &ec2.InstanceTypeInfo{
+			InstanceType:         aws.String("m7i.large"),
+			HibernationSupported: aws.Bool(hibernationSupported),
+			MemoryInfo:           &ec2.MemoryInfo{SizeInMiB: aws.Int64(memoryMiB)},
+		}
+	}
+
+	tests := []struct {
+		name             string
+		instanceTypeInfo *ec2.InstanceTypeInfo
+		image            *ec2.Image
+		wantErr          bool
+	}{
+		{name: "Supported", instanceTypeInfo: newInstanceTypeInfo(true, 8192), image: image},
+		{name: "Instance type without hibernation", instanceTypeInfo: newInstanceTypeInfo(false, 8192), image: image, wantErr: true},
+		{name: "Too much memory", instanceTypeInfo: newInstanceTypeInfo(true, 256*1024), image: image, wantErr: true},
+		{
+			name:             "Instance store image",
+			instanceTypeInfo: newInstanceTypeInfo(true, 8192),
+			image: &ec2.Image{
+				ImageId:            aws.String("ami-12345678"),
+				RootDeviceType:     aws.String(ec2.DeviceTypeInstanceStore),
+				VirtualizationType: aws.String(ec2.VirtualizationTypeHvm),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHibernationSupport(tt.instanceTypeInfo, tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkHibernationSupport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetHibernationVolumeSize(t *testing.T) {
+	tests := []struct {
+		volumeSize int
+		memoryMiB  int64
+		want       int64
+	}{
+		{volumeSize: 20, memoryMiB: 8192, want: 28},
+		{volumeSize: 20, memoryMiB: 1024 + 512, want: 22},
+		{volumeSize: 50, memoryMiB: 512, want: 51},
+	}
+
+	for _, tt := range tests {
+		got := getHibernationVolumeSize(tt.volumeSize, tt.memoryMiB)
+		if got != tt.want {
+			t.Errorf("getHibernationVolumeSize(%d, %d) = %d, want %d", tt.volumeSize, tt.memoryMiB, got, tt.want)
+		}
+	}
+}
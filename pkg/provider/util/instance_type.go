@@ -0,0 +1,63 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// getInstanceTypeInfo retrieves the description of an instance type.
+func getInstanceTypeInfo(client *ec2.EC2, instanceType string) (*ec2.InstanceTypeInfo, error) {
+	result, err := client.DescribeInstanceTypes(&ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []*string{aws.String(instanceType)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe instance type %s: %w", instanceType, err)
+	}
+
+	if len(result.InstanceTypes) == 0 {
+		return nil, fmt.Errorf("instance type %s not found", instanceType)
+	}
+
+	return result.InstanceTypes[0], nil
+}
+
+// isInstanceTypeOffered returns true if the instance type is offered in the
+// given location, either a region or an availability zone.
+func isInstanceTypeOffered(client *ec2.EC2, instanceType, locationType, location string) (bool, error) {
+	result, err := client.DescribeInstanceTypeOfferings(&ec2.DescribeInstanceTypeOfferingsInput{
+		LocationType: aws.String(locationType),
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-type"),
+				Values: []*string{aws.String(instanceType)},
+			},
+			{
+				Name:   aws.String("location"),
+				Values: []*string{aws.String(location)},
+			},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return len(result.InstanceTypeOfferings) > 0, nil
+}
+
+// supportsArchitecture returns true if the instance type can run images of
+// the given architecture.
+func supportsArchitecture(instanceTypeInfo *ec2.InstanceTypeInfo, architecture string) bool {
+	if instanceTypeInfo.ProcessorInfo == nil {
+		return false
+	}
+
+	for _, supportedArchitecture := range instanceTypeInfo.ProcessorInfo.SupportedArchitectures {
+		if aws.StringValue(supportedArchitecture) == architecture {
+			return true
+		}
+	}
+
+	return false
+}
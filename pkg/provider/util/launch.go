@@ -0,0 +1,323 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+// LaunchGenerationTagKey is the instance and data volume tag holding the
+// generation of the launch of the instance, see launchTargetInstance
+const LaunchGenerationTagKey = "DaytonaLaunchGeneration"
+
+var (
+	// launchedInstanceLookupTimeout is how long a launched instance is looked
+	// up for when its client token is refused
+	launchedInstanceLookupTimeout = 30 * time.Second
+	// launchedInstanceLookupInterval is the interval between the lookups
+	launchedInstanceLookupInterval = 5 * time.Second
+)
+
+// getLaunchedInstance returns the pending or running instance of a target, or
+// nil if the target has none, e.g. to resume a create that was interrupted
+// after the instance was launched.
+func getLaunchedInstance(client *ec2.EC2, targetId string) (*ec2.Instance, error) {
+	instances, err := listInstancesByWorkspaceID(client, targetId)
+	if err != nil {
+		return nil, err
+	}
+
+	var launched []*ec2.Instance
+	for _, instance := range instances {
+		state := aws.StringValue(instance.State.Name)
+		if state == ec2.InstanceStateNamePending || state == ec2.InstanceStateNameRunning {
+			launched = append(launched, instance)
+		}
+	}
+
+	if len(launched) == 0 {
+		return nil, nil
+	}
+
+	if len(launched) > 1 {
+		var instanceIds []string
+		for _, instance := range launched {
+			instanceIds = append(instanceIds, *instance.InstanceId)
+		}
+		return nil, fmt.Errorf("%w for target %s: %s", ErrMultipleInstances, targetId, strings.Join(instanceIds, ", "))
+	}
+
+	return launched[0], nil
+}
+
+// launchTargetInstance launches the instance of a target, falling back to
+// launching without hibernation or on-demand as configured.
+//
+// Launches are idempotent: each attempt has a client token derived from the
+// target id and the attempt, so a create that is retried before its instance
+// shows up in DescribeInstances gets the same instance back. Client tokens
+// outlive the instances they launched, so when the token returns a terminated
+// instance, e.g. because the target is recreated or its create was rolled
+// back, the launch is repeated with the token of the next generation.
+//
+// Uploaded user data is included from a presigned URL that changes with every
+// create, so a reused token can also be refused for launching an instance with
+// other parameters. The instance of the target is then looked up by its tags,
+// and if it has none, the launch moves on to the next generation.
+//
+// The launch starts from the given generation, see getLaunchGeneration, and
+// has no limit of generations: a generation is only skipped if its token
+// already launched an instance, so the launch ends after at most one attempt
+// per earlier launch of the target.
+func launchTargetInstance(client *ec2.EC2, input *ec2.RunInstancesInput, opts *types.TargetOptions, subnets []*ec2.Subnet, targetId string, generation int, logWriter io.Writer) (*ec2.Instance, error) {
+	for ; ; generation++ {
+		setLaunchGenerationTag(input, generation)
+
+		result, err := runInstancesWithFallback(client, input, opts, subnets, getLaunchToken(targetId, generation), logWriter)
+		if isClientTokenMismatchError(err) {
+			instance, err := findLaunchedInstance(client, targetId)
+			if err != nil {
+				return nil, err
+			}
+			if instance != nil {
+				logWriter.Write([]byte(fmt.Sprintf("Instance %s of the target is already launched, waiting for it\n", *instance.InstanceId)))
+				return instance, nil
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		// New instances are pending, an instance in another state was launched
+		// earlier with the same client token
+		instance := result.Instances[0]
+		if aws.StringValue(instance.State.Name) == ec2.InstanceStateNamePending {
+			return instance, nil
+		}
+
+		instance, err = describeInstance(client, instance.InstanceId)
+		if err != nil {
+			return nil, err
+		}
+
+		if !isTerminatedInstance(instance) {
+			return instance, nil
+		}
+	}
+}
+
+// getLaunchGeneration returns the generation the next launch of a target
+// starts from: the generation after the last one that launched an instance
+// since terminated, according to the instances of the target that are still
+// described and its data volume, which outlives them.
+func getLaunchGeneration(client *ec2.EC2, targetId string, dataVolume *ec2.Volume) (int, error) {
+	var instances []*ec2.Instance
+	err := client.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:WorkspaceID"),
+				Values: []*string{aws.String(targetId)},
+			},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			instances = append(instances, reservation.Instances...)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return getNextLaunchGeneration(instances, dataVolume), nil
+}
+
+// getNextLaunchGeneration returns the generation to start launching from, see
+// getLaunchGeneration. The generation of an instance that is not terminated is
+// tried again, as its token returns that instance.
+func getNextLaunchGeneration(instances []*ec2.Instance, dataVolume *ec2.Volume) int {
+	var next int
+	if dataVolume != nil {
+		// The instance the data volume was attached to may be terminated, but its
+		// generation is only skipped once RunInstances returns it
+		next = getTagsLaunchGeneration(dataVolume.Tags)
+	}
+
+	for _, instance := range instances {
+		generation := getTagsLaunchGeneration(instance.Tags)
+		if isTerminatedInstance(instance) {
+			generation++
+		}
+		if generation > next {
+			next = generation
+		}
+	}
+
+	return next
+}
+
+// getTagsLaunchGeneration returns the launch generation in the tags, or 0 if
+// they have none.
+func getTagsLaunchGeneration(tags []*ec2.Tag) int {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) != LaunchGenerationTagKey {
+			continue
+		}
+
+		generation, err := strconv.Atoi(aws.StringValue(tag.Value))
+		if err != nil || generation < 0 {
+			return 0
+		}
+		return generation
+	}
+
+	return 0
+}
+
+// setLaunchGenerationTag tags the instance launched with the input with its
+// launch generation.
+func setLaunchGenerationTag(input *ec2.RunInstancesInput, generation int) {
+	tags := input.TagSpecifications[0].Tags
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == LaunchGenerationTagKey {
+			tag.Value = aws.String(strconv.Itoa(generation))
+			return
+		}
+	}
+
+	input.TagSpecifications[0].Tags = append(tags, &ec2.Tag{
+		Key:   aws.String(LaunchGenerationTagKey),
+		Value: aws.String(strconv.Itoa(generation)),
+	})
+}
+
+// recordLaunchGeneration copies the launch generation of the instance to the
+// data volume attached to it, so that it outlives the instance.
+func recordLaunchGeneration(client *ec2.EC2, dataVolume *ec2.Volume, instance *ec2.Instance) error {
+	for _, tag := range instance.Tags {
+		if aws.StringValue(tag.Key) != LaunchGenerationTagKey {
+			continue
+		}
+
+		_, err := client.CreateTags(&ec2.CreateTagsInput{
+			Resources: []*string{dataVolume.VolumeId},
+			Tags:      []*ec2.Tag{tag},
+		})
+		return err
+	}
+
+	return nil
+}
+
+func isTerminatedInstance(instance *ec2.Instance) bool {
+	state := aws.StringValue(instance.State.Name)
+	return state == ec2.InstanceStateNameShuttingDown || state == ec2.InstanceStateNameTerminated
+}
+
+// getLaunchToken returns the launch token of a generation of launches of a
+// target, from which the client tokens of its attempts are derived.
+func getLaunchToken(targetId string, generation int) string {
+	if generation == 0 {
+		return targetId
+	}
+	return fmt.Sprintf("%s/%d", targetId, generation)
+}
+
+// isClientTokenMismatchError returns true if RunInstances refused a client
+// token that was used before with other parameters.
+func isClientTokenMismatchError(err error) bool {
+	return isAwsErrorCode(err, "IdempotentParameterMismatch")
+}
+
+// findLaunchedInstance waits for the pending or running instance of a target
+// to show up in DescribeInstances, which is eventually consistent. It returns
+// nil if the target has no such instance after launchedInstanceLookupTimeout.
+func findLaunchedInstance(client *ec2.EC2, targetId string) (*ec2.Instance, error) {
+	deadline := time.Now().Add(launchedInstanceLookupTimeout)
+	for {
+		instance, err := getLaunchedInstance(client, targetId)
+		if err != nil || instance != nil {
+			return instance, err
+		}
+
+		if time.Now().After(deadline) {
+			return nil, nil
+		}
+		time.Sleep(launchedInstanceLookupInterval)
+	}
+}
+
+func runInstancesWithFallback(client *ec2.EC2, input *ec2.RunInstancesInput, opts *types.TargetOptions, subnets []*ec2.Subnet, launchToken string, logWriter io.Writer) (*ec2.Reservation, error) {
+	result, err := runInstancesWithInstanceProfile(client, input, opts, subnets, launchToken, logWriter)
+	if err != nil && input.HibernationOptions != nil && isHibernationConfigurationError(err) {
+		logWriter.Write([]byte(fmt.Sprintf("Hibernation not supported (%s), launching the instance without it\n", err.Error())))
+		disableHibernation(input, opts)
+		result, err = runInstancesWithInstanceProfile(client, input, opts, subnets, launchToken, logWriter)
+	}
+	if err != nil && opts.PurchasingOption == types.PurchasingOptionSpotWithFallback && isSpotFallbackError(err) {
+		logWriter.Write([]byte(fmt.Sprintf("Spot capacity not available (%s), falling back to on-demand\n", err.Error())))
+		input.InstanceMarketOptions = nil
+		result, err = runInstancesWithInstanceProfile(client, input, opts, subnets, launchToken, logWriter)
+	}
+
+	return result, err
+}
+
+// getClientToken returns the client token of a launch attempt. RunInstances
+// refuses a client token reused with other parameters, so the token changes
+// with the parameters that differ between the attempts of a launch: the
+// subnet, the purchasing option and hibernation. The image and instance type
+// are included so that a target launched with new options gets a new instance.
+func getClientToken(launchToken string, input *ec2.RunInstancesInput) string {
+	var subnetId string
+	if len(input.NetworkInterfaces) > 0 {
+		subnetId = aws.StringValue(input.NetworkInterfaces[0].SubnetId)
+	}
+
+	hibernation := input.HibernationOptions != nil && aws.BoolValue(input.HibernationOptions.Configured)
+
+	hash := sha256.Sum256([]byte(strings.Join([]string{
+		launchToken,
+		aws.StringValue(input.ImageId),
+		aws.StringValue(input.InstanceType),
+		subnetId,
+		fmt.Sprintf("spot=%t", input.InstanceMarketOptions != nil),
+		fmt.Sprintf("hibernation=%t", hibernation),
+	}, "\n")))
+
+	// Client tokens are at most 64 ASCII characters, the length of the hex encoded hash
+	return hex.EncodeToString(hash[:])
+}
+
+func setClientToken(input *ec2.RunInstancesInput, launchToken string) {
+	if launchToken == "" {
+		input.ClientToken = nil
+		return
+	}
+
+	input.ClientToken = aws.String(getClientToken(launchToken, input))
+}
+
+func describeInstance(client *ec2.EC2, instanceId *string) (*ec2.Instance, error) {
+	result, err := client.DescribeInstances(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{instanceId},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Reservations) == 0 || len(result.Reservations[0].Instances) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInstanceNotFound, aws.StringValue(instanceId))
+	}
+
+	return result.Reservations[0].Instances[0], nil
+}
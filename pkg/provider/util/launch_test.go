@@ -0,0 +1,221 @@
+package util
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+func TestGetClientToken(t *testing.T) {
+	opts := &types.TargetOptions{
+		InstanceType:     "t3.medium",
+		DeviceName:       "/dev/sda1",
+		VolumeSize:       30,
+		VolumeType:       "gp3",
+		PurchasingOption: types.PurchasingOptionSpot,
+	}
+	newInput := func() *ec2.RunInstancesInput {
+		return getRunInstancesInput("target-1", opts, &ec2.Image{ImageId: aws.String("ami-0123")}, "")
+	}
+
+	token := getClientToken("target-1", newInput())
+	if len(token) > 64 {
+		t.Errorf("getClientToken() = %q, longer than 64 characters", token)
+	}
+	if getClientToken("target-1", newInput()) != token {
+		t.Errorf("getClientToken() is not stable across retries of a launch")
+	}
+
+	differentAttempts := map[string]struct {
+		launchToken string
+		input       func() *ec2.RunInstancesInput
+	}{
+		"Other target":    {launchToken: "target-2", input: newInput},
+		"Next generation": {launchToken: "target-1/i-0123", input: newInput},
+		"Other subnet": {launchToken: "target-1", input: func() *ec2.RunInstancesInput {
+			input := newInput()
+			input.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{{SubnetId: aws.String("subnet-0123")}}
+			return input
+		}},
+		"On-demand fallback": {launchToken: "target-1", input: func() *ec2.RunInstancesInput {
+			input := newInput()
+			input.InstanceMarketOptions = nil
+			return input
+		}},
+		"Hibernation": {launchToken: "target-1", input: func() *ec2.RunInstancesInput {
+			input := newInput()
+			input.HibernationOptions = &ec2.HibernationOptionsRequest{Configured: aws.Bool(true)}
+			return input
+		}},
+	}
+	for name, attempt := range differentAttempts {
+		if getClientToken(attempt.launchToken, attempt.input()) == token {
+			t.Errorf("%s: getClientToken() returned the token of another attempt", name)
+		}
+	}
+}
+
+func TestGetRunInstancesInputIsStable(t *testing.T) {
+	// RunInstances refuses a client token reused with other parameters, so the
+	// input of a retried launch must not change over time
+	opts := &types.TargetOptions{InstanceType: "t3.medium", TTL: "8h"}
+	image := &ec2.Image{ImageId: aws.String("ami-0123")}
+
+	input := getRunInstancesInput("target-1", opts, image, "")
+	time.Sleep(1100 * time.Millisecond)
+	if getRunInstancesInput("target-1", opts, image, "").String() != input.String() {
+		t.Errorf("getRunInstancesInput() changed between two launches of the same target")
+	}
+}
+
+// fakeEc2 serves RunInstances with the given function and DescribeInstances
+// with the given instances, and records the client tokens of the launches.
+type fakeEc2 struct {
+	runInstances func(clientToken string) (string, int)
+	instances    string
+	clientTokens []string
+}
+
+func (f *fakeEc2) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	switch r.Form.Get("Action") {
+	case "RunInstances":
+		clientToken := r.Form.Get("ClientToken")
+		f.clientTokens = append(f.clientTokens, clientToken)
+
+		body, status := f.runInstances(clientToken)
+		w.WriteHeader(status)
+		io.WriteString(w, body)
+	case "DescribeInstances":
+		io.WriteString(w, fmt.Sprintf("<DescribeInstancesResponse><reservationSet>%s</reservationSet></DescribeInstancesResponse>", f.instances))
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func newFakeEc2Client(t *testing.T, fake *fakeEc2) *ec2.EC2 {
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	return ec2.New(session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})))
+}
+
+const clientTokenMismatchResponse = "<Response><Errors><Error><Code>IdempotentParameterMismatch</Code><Message>mismatch</Message></Error></Errors></Response>"
+
+func getInstanceXml(instanceId, state string) string {
+	return fmt.Sprintf("<item><instanceId>%s</instanceId><instanceState><name>%s</name></instanceState></item>", instanceId, state)
+}
+
+func TestLaunchTargetInstanceClientTokenMismatch(t *testing.T) {
+	launchedInstanceLookupTimeout, launchedInstanceLookupInterval = 0, 0
+	defer func() {
+		launchedInstanceLookupTimeout, launchedInstanceLookupInterval = 30*time.Second, 5*time.Second
+	}()
+
+	opts := &types.TargetOptions{InstanceType: "t3.medium"}
+	newInput := func() *ec2.RunInstancesInput {
+		return getRunInstancesInput("target-1", opts, &ec2.Image{ImageId: aws.String("ami-0123")}, "")
+	}
+
+	t.Run("Resumes the launched instance", func(t *testing.T) {
+		fake := &fakeEc2{
+			runInstances: func(string) (string, int) {
+				return clientTokenMismatchResponse, http.StatusBadRequest
+			},
+			instances: "<item><instancesSet>" + getInstanceXml("i-launched", ec2.InstanceStateNameRunning) + "</instancesSet></item>",
+		}
+
+		instance, err := launchTargetInstance(newFakeEc2Client(t, fake), newInput(), opts, nil, "target-1", 0, io.Discard)
+		if err != nil {
+			t.Fatalf("launchTargetInstance() error = %v", err)
+		}
+		if aws.StringValue(instance.InstanceId) != "i-launched" || len(fake.clientTokens) != 1 {
+			t.Errorf("launchTargetInstance() = %s after %d launches, want the launched instance after 1 launch", aws.StringValue(instance.InstanceId), len(fake.clientTokens))
+		}
+	})
+
+	t.Run("Moves on to the next generation", func(t *testing.T) {
+		firstToken := getClientToken(getLaunchToken("target-1", 0), newInput())
+		fake := &fakeEc2{
+			runInstances: func(clientToken string) (string, int) {
+				if clientToken == firstToken {
+					return clientTokenMismatchResponse, http.StatusBadRequest
+				}
+				return "<RunInstancesResponse><instancesSet>" + getInstanceXml("i-new", ec2.InstanceStateNamePending) + "</instancesSet></RunInstancesResponse>", http.StatusOK
+			},
+		}
+
+		instance, err := launchTargetInstance(newFakeEc2Client(t, fake), newInput(), opts, nil, "target-1", 0, io.Discard)
+		if err != nil {
+			t.Fatalf("launchTargetInstance() error = %v", err)
+		}
+		if aws.StringValue(instance.InstanceId) != "i-new" || len(fake.clientTokens) != 2 || fake.clientTokens[1] == firstToken {
+			t.Errorf("launchTargetInstance() = %s with client tokens %v, want a new instance launched with a second token", aws.StringValue(instance.InstanceId), fake.clientTokens)
+		}
+	})
+}
+
+func TestGetNextLaunchGeneration(t *testing.T) {
+	newInstance := func(state string, generation string) *ec2.Instance {
+		instance := &ec2.Instance{State: &ec2.InstanceState{Name: aws.String(state)}}
+		if generation != "" {
+			instance.Tags = []*ec2.Tag{{Key: aws.String(LaunchGenerationTagKey), Value: aws.String(generation)}}
+		}
+		return instance
+	}
+	dataVolume := &ec2.Volume{Tags: []*ec2.Tag{{Key: aws.String(LaunchGenerationTagKey), Value: aws.String("7")}}}
+
+	tests := []struct {
+		name       string
+		instances  []*ec2.Instance
+		dataVolume *ec2.Volume
+		want       int
+	}{
+		{name: "First launch", want: 0},
+		{name: "Untagged instance", instances: []*ec2.Instance{newInstance(ec2.InstanceStateNameTerminated, "")}, want: 1},
+		{name: "Terminated instance", instances: []*ec2.Instance{newInstance(ec2.InstanceStateNameTerminated, "3")}, want: 4},
+		{name: "Stopped instance", instances: []*ec2.Instance{newInstance(ec2.InstanceStateNameStopped, "3")}, want: 3},
+		{name: "Data volume outlives the instances", instances: []*ec2.Instance{newInstance(ec2.InstanceStateNameTerminated, "3")}, dataVolume: dataVolume, want: 7},
+		{name: "Last instance of the data volume", instances: []*ec2.Instance{newInstance(ec2.InstanceStateNameShuttingDown, "7")}, dataVolume: dataVolume, want: 8},
+		{name: "Invalid tag", instances: []*ec2.Instance{newInstance(ec2.InstanceStateNameStopped, "latest")}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getNextLaunchGeneration(tt.instances, tt.dataVolume); got != tt.want {
+				t.Errorf("getNextLaunchGeneration() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetLaunchGenerationTag(t *testing.T) {
+	input := getRunInstancesInput("target-1", &types.TargetOptions{InstanceType: "t3.medium"}, &ec2.Image{ImageId: aws.String("ami-0123")}, "")
+
+	setLaunchGenerationTag(input, 0)
+	setLaunchGenerationTag(input, 2)
+
+	tags := input.TagSpecifications[0].Tags
+	if got := getTagsLaunchGeneration(tags); got != 2 || len(tags) != 5 {
+		t.Errorf("setLaunchGenerationTag() tagged generation %d with %d tags, want generation 2 with 5 tags", got, len(tags))
+	}
+}
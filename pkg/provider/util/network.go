@@ -0,0 +1,124 @@
+package util
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+// subnetFallbackErrorCodes are the RunInstances error codes for which the
+// launch is retried in the next configured subnet.
+var subnetFallbackErrorCodes = map[string]bool{
+	"InsufficientInstanceCapacity":      true,
+	"InsufficientFreeAddressesInSubnet": true,
+	"Unsupported":                       true,
+}
+
+// getSubnets retrieves the configured subnets, in the configured order, and
+// validates that they exist in the region and belong to the same VPC.
+func getSubnets(client *ec2.EC2, opts *types.TargetOptions) ([]*ec2.Subnet, error) {
+	subnetIds := opts.SubnetIdList()
+	if len(subnetIds) == 0 {
+		return nil, nil
+	}
+
+	result, err := client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		SubnetIds: aws.StringSlice(subnetIds),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find subnets %v in region %s: %w", subnetIds, opts.Region, err)
+	}
+
+	subnetsById := map[string]*ec2.Subnet{}
+	for _, subnet := range result.Subnets {
+		subnetsById[*subnet.SubnetId] = subnet
+	}
+
+	var subnets []*ec2.Subnet
+	for _, subnetId := range subnetIds {
+		subnet, ok := subnetsById[subnetId]
+		if !ok {
+			return nil, fmt.Errorf("subnet %s not found in region %s", subnetId, opts.Region)
+		}
+
+		if len(subnets) > 0 && *subnet.VpcId != *subnets[0].VpcId {
+			return nil, fmt.Errorf("subnets must belong to the same VPC, %s is in %s", subnetId, *subnet.VpcId)
+		}
+
+		subnets = append(subnets, subnet)
+	}
+
+	return subnets, nil
+}
+
+// validateSecurityGroups validates that the configured security groups exist
+// in the region and belong to the VPC of the configured subnets.
+func validateSecurityGroups(client *ec2.EC2, opts *types.TargetOptions, subnets []*ec2.Subnet) error {
+	securityGroupIds := opts.SecurityGroupIdList()
+	if len(securityGroupIds) == 0 {
+		return nil
+	}
+
+	result, err := client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		GroupIds: aws.StringSlice(securityGroupIds),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find security groups %v in region %s: %w", securityGroupIds, opts.Region, err)
+	}
+
+	if len(subnets) == 0 {
+		return nil
+	}
+
+	for _, securityGroup := range result.SecurityGroups {
+		if *securityGroup.VpcId != *subnets[0].VpcId {
+			return fmt.Errorf("security group %s is in %s, but the subnets are in %s", *securityGroup.GroupId, *securityGroup.VpcId, *subnets[0].VpcId)
+		}
+	}
+
+	return nil
+}
+
+// runInstances launches the instance in the first configured subnet that has
+// capacity for it. Without configured subnets, the instance is launched in the
+// default subnet of the region. If a launch token is set, each attempt has a
+// client token derived from it, see getClientToken.
+func runInstances(client *ec2.EC2, input *ec2.RunInstancesInput, opts *types.TargetOptions, subnets []*ec2.Subnet, launchToken string) (*ec2.Reservation, error) {
+	securityGroupIds := aws.StringSlice(opts.SecurityGroupIdList())
+
+	if len(subnets) == 0 {
+		input.SecurityGroupIds = securityGroupIds
+		setClientToken(input, launchToken)
+		return client.RunInstances(input)
+	}
+
+	var err error
+	for _, subnet := range subnets {
+		input.NetworkInterfaces = []*ec2.InstanceNetworkInterfaceSpecification{
+			{
+				DeviceIndex:              aws.Int64(0),
+				SubnetId:                 subnet.SubnetId,
+				Groups:                   securityGroupIds,
+				AssociatePublicIpAddress: opts.AssociatePublicIp,
+				DeleteOnTermination:      aws.Bool(true),
+			},
+		}
+		setClientToken(input, launchToken)
+
+		var reservation *ec2.Reservation
+		reservation, err = client.RunInstances(input)
+		if err == nil {
+			return reservation, nil
+		}
+
+		awsErr, ok := err.(awserr.Error)
+		if !ok || !subnetFallbackErrorCodes[awsErr.Code()] {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
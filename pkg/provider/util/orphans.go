@@ -0,0 +1,510 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+// DefaultOrphanGracePeriod is how old the newest resource of an orphaned
+// target must be before the target is collected, so that targets still being
+// created are never collected
+const DefaultOrphanGracePeriod = time.Hour
+
+const (
+	OrphanResourceInstance        = "instance"
+	OrphanResourceDataVolume      = "data-volume"
+	OrphanResourceSecretParameter = "ssm-parameter"
+	OrphanResourceRole            = "iam-role"
+	OrphanResourceUserData        = "s3-object"
+)
+
+const (
+	// OrphanActionReported is the action of orphans found without deleting them
+	OrphanActionReported = "reported"
+	// OrphanActionWouldDelete is the action of orphans that a dry run would delete
+	OrphanActionWouldDelete = "would-delete"
+	OrphanActionDeleted     = "deleted"
+	OrphanActionFailed      = "failed"
+	// OrphanActionGracePeriod is the action of orphans of a target with resources newer than the grace period
+	OrphanActionGracePeriod = "grace-period"
+	// OrphanActionRetained is the action of data volumes with the retain deletion policy
+	OrphanActionRetained = "retained"
+	// OrphanActionSkipped is the action of orphans kept because the instances of their target failed to terminate
+	OrphanActionSkipped = "skipped"
+)
+
+// OrphanCollectionOptions configures the collection of orphaned resources.
+type OrphanCollectionOptions struct {
+	// KnownTargetIds are the ids of the targets that exist on the Daytona server
+	KnownTargetIds []string
+	// GracePeriod is how old the newest resource of an orphaned target must be
+	// before the target is collected, DefaultOrphanGracePeriod if zero
+	GracePeriod time.Duration
+	// Delete deletes the orphans instead of only reporting them
+	Delete bool
+	// DryRun reports the orphans that would be deleted without deleting them
+	DryRun bool
+	// AuditLog receives a JSON line for each orphan and the action taken on it
+	AuditLog io.Writer
+}
+
+// Orphan is a resource of a target that no longer exists on the Daytona
+// server, e.g. after a failed create or a manual deletion on the server side.
+type Orphan struct {
+	TargetId     string    `json:"targetId"`
+	ResourceType string    `json:"resourceType"`
+	ResourceId   string    `json:"resourceId"`
+	Created      time.Time `json:"created"`
+	Action       string    `json:"action"`
+	Error        string    `json:"error,omitempty"`
+
+	instance *ec2.Instance
+	retained bool
+}
+
+// CollectOrphans finds the Daytona resources in the region of the target
+// options whose target is not known, and deletes them if enabled. IAM roles
+// are global, so the known target ids must include the targets of all regions.
+// Uploaded user data is only checked in the User Data Bucket of the options.
+func CollectOrphans(opts *types.TargetOptions, collectionOpts *OrphanCollectionOptions, logWriter io.Writer) ([]*Orphan, error) {
+	sess, err := getSession(opts, "orphans")
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := listTargetResources(sess, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	gracePeriod := collectionOpts.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = DefaultOrphanGracePeriod
+	}
+
+	orphans := planOrphanCollection(resources, collectionOpts.KnownTargetIds, time.Now(), gracePeriod, collectionOpts.Delete, collectionOpts.DryRun)
+
+	// Instances are terminated first, so that their data volumes are detached.
+	// The other resources of a target whose instances fail to terminate are
+	// kept, so that no instance is left without its role and secrets
+	instances := map[string][]*ec2.Instance{}
+	var targetIds []string
+	for _, orphan := range orphans {
+		if orphan.Action == OrphanActionDeleted && orphan.ResourceType == OrphanResourceInstance {
+			if _, ok := instances[orphan.TargetId]; !ok {
+				targetIds = append(targetIds, orphan.TargetId)
+			}
+			instances[orphan.TargetId] = append(instances[orphan.TargetId], orphan.instance)
+		}
+	}
+
+	failedTargets := map[string]error{}
+	for _, targetId := range targetIds {
+		logWriter.Write([]byte(fmt.Sprintf("Terminating %d orphaned instances of target %s\n", len(instances[targetId]), targetId)))
+		err = terminateInstances(ec2.New(sess), instances[targetId])
+		if err != nil {
+			failedTargets[targetId] = err
+		}
+	}
+	markFailedOrphanTargets(orphans, failedTargets)
+
+	for _, orphan := range orphans {
+		if orphan.Action == OrphanActionDeleted && orphan.ResourceType != OrphanResourceInstance {
+			err = deleteOrphan(sess, opts, orphan)
+			if err != nil {
+				orphan.Action = OrphanActionFailed
+				orphan.Error = err.Error()
+			}
+		}
+
+		logWriter.Write([]byte(fmt.Sprintf("Orphaned %s %s of target %s: %s\n", orphan.ResourceType, orphan.ResourceId, orphan.TargetId, orphan.Action)))
+	}
+
+	if collectionOpts.AuditLog != nil {
+		err = writeOrphanAuditLog(collectionOpts.AuditLog, opts.Region, orphans, time.Now())
+		if err != nil {
+			return orphans, err
+		}
+	}
+
+	return orphans, nil
+}
+
+// markFailedOrphanTargets marks the instances of the targets whose instances
+// failed to terminate as failed, and skips the other resources to delete of
+// these targets.
+func markFailedOrphanTargets(orphans []*Orphan, failedTargets map[string]error) {
+	for _, orphan := range orphans {
+		err, ok := failedTargets[orphan.TargetId]
+		if !ok || orphan.Action != OrphanActionDeleted {
+			continue
+		}
+
+		if orphan.ResourceType == OrphanResourceInstance {
+			orphan.Action = OrphanActionFailed
+			orphan.Error = err.Error()
+		} else {
+			orphan.Action = OrphanActionSkipped
+			orphan.Error = "the instances of the target failed to terminate: " + err.Error()
+		}
+	}
+}
+
+// planOrphanCollection returns the resources of unknown targets, with the
+// action to take on them. The resources of a target are collected together,
+// once the newest of them is older than the grace period.
+func planOrphanCollection(resources []*Orphan, knownTargetIds []string, now time.Time, gracePeriod time.Duration, deleteOrphans, dryRun bool) []*Orphan {
+	known := map[string]bool{}
+	for _, targetId := range knownTargetIds {
+		known[targetId] = true
+	}
+
+	newest := map[string]time.Time{}
+	for _, resource := range resources {
+		if resource.Created.After(newest[resource.TargetId]) {
+			newest[resource.TargetId] = resource.Created
+		}
+	}
+
+	var orphans []*Orphan
+	for _, resource := range resources {
+		// Resources without a WorkspaceID tag cannot be tied to a target
+		if resource.TargetId == "" || known[resource.TargetId] {
+			continue
+		}
+
+		switch {
+		case resource.retained:
+			resource.Action = OrphanActionRetained
+		case !deleteOrphans:
+			resource.Action = OrphanActionReported
+		case now.Sub(newest[resource.TargetId]) < gracePeriod:
+			resource.Action = OrphanActionGracePeriod
+		case dryRun:
+			resource.Action = OrphanActionWouldDelete
+		default:
+			resource.Action = OrphanActionDeleted
+		}
+		orphans = append(orphans, resource)
+	}
+
+	sort.SliceStable(orphans, func(i, j int) bool {
+		return orphans[i].TargetId < orphans[j].TargetId
+	})
+
+	return orphans
+}
+
+func deleteOrphan(sess *session.Session, opts *types.TargetOptions, orphan *Orphan) error {
+	switch orphan.ResourceType {
+	case OrphanResourceDataVolume:
+		return deleteDataVolume(ec2.New(sess), orphan.TargetId)
+	case OrphanResourceSecretParameter:
+		return deleteSecretsParameter(sess, orphan.ResourceId)
+	case OrphanResourceRole:
+		return deleteTargetRole(sess, orphan.ResourceId)
+	case OrphanResourceUserData:
+		return deleteUserData(sess, opts, orphan.TargetId)
+	}
+
+	return fmt.Errorf("unknown resource type %s", orphan.ResourceType)
+}
+
+// writeOrphanAuditLog writes a JSON line for each orphan to the audit log.
+func writeOrphanAuditLog(auditLog io.Writer, region string, orphans []*Orphan, now time.Time) error {
+	for _, orphan := range orphans {
+		entry, err := json.Marshal(struct {
+			Time   time.Time `json:"time"`
+			Region string    `json:"region"`
+			*Orphan
+		}{
+			Time:   now.UTC(),
+			Region: region,
+			Orphan: orphan,
+		})
+		if err != nil {
+			return err
+		}
+
+		_, err = auditLog.Write(append(entry, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listTargetResources lists the resources of all targets in the region.
+func listTargetResources(sess *session.Session, opts *types.TargetOptions) ([]*Orphan, error) {
+	var resources []*Orphan
+
+	for _, list := range []func(*session.Session, *types.TargetOptions) ([]*Orphan, error){
+		listTargetInstances,
+		listTargetDataVolumes,
+		listTargetSecretsParameters,
+		listTargetRoles,
+		listTargetUserData,
+	} {
+		listed, err := list(sess, opts)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, listed...)
+	}
+
+	return resources, nil
+}
+
+func listTargetInstances(sess *session.Session, opts *types.TargetOptions) ([]*Orphan, error) {
+	var resources []*Orphan
+
+	err := ec2.New(sess).DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []*string{aws.String("WorkspaceID")},
+			},
+			{
+				Name:   aws.String("tag:Name"),
+				Values: []*string{aws.String("daytona-*")},
+			},
+			{
+				Name: aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{
+					ec2.InstanceStateNamePending,
+					ec2.InstanceStateNameRunning,
+					ec2.InstanceStateNameStopping,
+					ec2.InstanceStateNameStopped,
+				}),
+			},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				resources = append(resources, &Orphan{
+					TargetId:     getEc2TagValue(instance.Tags, "WorkspaceID"),
+					ResourceType: OrphanResourceInstance,
+					ResourceId:   aws.StringValue(instance.InstanceId),
+					Created:      aws.TimeValue(instance.LaunchTime),
+					instance:     instance,
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list instances: %w", err)
+	}
+
+	return resources, nil
+}
+
+func listTargetDataVolumes(sess *session.Session, opts *types.TargetOptions) ([]*Orphan, error) {
+	var resources []*Orphan
+
+	err := ec2.New(sess).DescribeVolumesPages(&ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []*string{aws.String("WorkspaceID")},
+			},
+			{
+				Name:   aws.String("tag:" + VolumeTagKey),
+				Values: []*string{aws.String(VolumeTagValue)},
+			},
+		},
+	}, func(page *ec2.DescribeVolumesOutput, lastPage bool) bool {
+		for _, volume := range page.Volumes {
+			resources = append(resources, &Orphan{
+				TargetId:     getEc2TagValue(volume.Tags, "WorkspaceID"),
+				ResourceType: OrphanResourceDataVolume,
+				ResourceId:   aws.StringValue(volume.VolumeId),
+				Created:      aws.TimeValue(volume.CreateTime),
+				retained:     getEc2TagValue(volume.Tags, DeletionPolicyTagKey) == types.DeletionPolicyRetain,
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list data volumes: %w", err)
+	}
+
+	return resources, nil
+}
+
+func listTargetSecretsParameters(sess *session.Session, opts *types.TargetOptions) ([]*Orphan, error) {
+	var resources []*Orphan
+
+	err := ssm.New(sess).DescribeParametersPages(&ssm.DescribeParametersInput{
+		ParameterFilters: []*ssm.ParameterStringFilter{
+			{
+				Key:    aws.String("Path"),
+				Option: aws.String("Recursive"),
+				Values: []*string{aws.String(secretsParameterPrefix)},
+			},
+		},
+	}, func(page *ssm.DescribeParametersOutput, lastPage bool) bool {
+		for _, parameter := range page.Parameters {
+			targetId, ok := getSecretsParameterTargetId(aws.StringValue(parameter.Name))
+			if !ok {
+				continue
+			}
+
+			resources = append(resources, &Orphan{
+				TargetId:     targetId,
+				ResourceType: OrphanResourceSecretParameter,
+				ResourceId:   aws.StringValue(parameter.Name),
+				Created:      aws.TimeValue(parameter.LastModifiedDate),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list SSM parameters: %w", err)
+	}
+
+	return resources, nil
+}
+
+func listTargetRoles(sess *session.Session, opts *types.TargetOptions) ([]*Orphan, error) {
+	client := iam.New(sess)
+
+	var roles []*iam.Role
+	err := client.ListRolesPages(&iam.ListRolesInput{}, func(page *iam.ListRolesOutput, lastPage bool) bool {
+		for _, role := range page.Roles {
+			if strings.HasPrefix(aws.StringValue(role.RoleName), targetRoleNamePrefix) {
+				roles = append(roles, role)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list IAM roles: %w", err)
+	}
+
+	var resources []*Orphan
+	for _, role := range roles {
+		// Role names are truncated for long target ids, the target id is read from the role tags
+		result, err := client.ListRoleTags(&iam.ListRoleTagsInput{
+			RoleName: role.RoleName,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the tags of IAM role %s: %w", aws.StringValue(role.RoleName), err)
+		}
+
+		var targetId string
+		for _, tag := range result.Tags {
+			if aws.StringValue(tag.Key) == "WorkspaceID" {
+				targetId = aws.StringValue(tag.Value)
+			}
+		}
+		if targetId == "" {
+			continue
+		}
+
+		resources = append(resources, &Orphan{
+			TargetId:     targetId,
+			ResourceType: OrphanResourceRole,
+			ResourceId:   aws.StringValue(role.RoleName),
+			Created:      aws.TimeValue(role.CreateDate),
+		})
+	}
+
+	return resources, nil
+}
+
+func listTargetUserData(sess *session.Session, opts *types.TargetOptions) ([]*Orphan, error) {
+	if opts.UserDataBucket == "" {
+		return nil, nil
+	}
+
+	client, err := getUserDataS3Client(sess, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*Orphan
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(opts.UserDataBucket),
+		Prefix: aws.String(opts.UserDataPrefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range page.Contents {
+			targetId, ok := getUserDataTargetId(opts, aws.StringValue(object.Key))
+			if !ok {
+				continue
+			}
+
+			resources = append(resources, &Orphan{
+				TargetId:     targetId,
+				ResourceType: OrphanResourceUserData,
+				ResourceId:   fmt.Sprintf("s3://%s/%s", opts.UserDataBucket, aws.StringValue(object.Key)),
+				Created:      aws.TimeValue(object.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the user data in bucket %s: %w", opts.UserDataBucket, err)
+	}
+
+	return resources, nil
+}
+
+// getSecretsParameterTargetId returns the target id of a secrets parameter
+// name, see getSecretsParameterName.
+func getSecretsParameterTargetId(parameterName string) (string, bool) {
+	targetId, ok := strings.CutPrefix(parameterName, secretsParameterPrefix+"/")
+	if !ok {
+		return "", false
+	}
+
+	targetId, ok = strings.CutSuffix(targetId, "/env")
+	if !ok || targetId == "" || strings.Contains(targetId, "/") {
+		return "", false
+	}
+
+	return targetId, true
+}
+
+// getUserDataTargetId returns the target id of an uploaded user data key, see
+// getUserDataKey.
+func getUserDataTargetId(opts *types.TargetOptions, key string) (string, bool) {
+	prefix := path.Clean(opts.UserDataPrefix)
+	if prefix != "." {
+		var ok bool
+		key, ok = strings.CutPrefix(key, prefix+"/")
+		if !ok {
+			return "", false
+		}
+	}
+
+	targetId, ok := strings.CutSuffix(key, "/user-data")
+	if !ok || targetId == "" || strings.Contains(targetId, "/") {
+		return "", false
+	}
+
+	return targetId, true
+}
+
+func getEc2TagValue(tags []*ec2.Tag, key string) string {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
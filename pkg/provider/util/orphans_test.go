@@ -0,0 +1,162 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+func TestPlanOrphanCollection(t *testing.T) {
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	newResources := func() []*Orphan {
+		return []*Orphan{
+			{TargetId: "known", ResourceType: OrphanResourceInstance, ResourceId: "i-known", Created: now.Add(-48 * time.Hour)},
+			{TargetId: "old", ResourceType: OrphanResourceInstance, ResourceId: "i-old", Created: now.Add(-48 * time.Hour)},
+			{TargetId: "old", ResourceType: OrphanResourceRole, ResourceId: "daytona-target-old", Created: now.Add(-48 * time.Hour)},
+			{TargetId: "old", ResourceType: OrphanResourceDataVolume, ResourceId: "vol-retained", Created: now.Add(-48 * time.Hour), retained: true},
+			// The parameter was just rewritten, the whole target is still in its grace period
+			{TargetId: "recent", ResourceType: OrphanResourceInstance, ResourceId: "i-recent", Created: now.Add(-48 * time.Hour)},
+			{TargetId: "recent", ResourceType: OrphanResourceSecretParameter, ResourceId: "/daytona/targets/recent/env", Created: now.Add(-10 * time.Minute)},
+			// A resource without a WorkspaceID tag is never collected
+			{ResourceType: OrphanResourceDataVolume, ResourceId: "vol-untagged", Created: now.Add(-48 * time.Hour)},
+		}
+	}
+
+	tests := []struct {
+		name          string
+		deleteOrphans bool
+		dryRun        bool
+		want          map[string]string
+	}{
+		{
+			name: "Report",
+			want: map[string]string{
+				"i-old":                       OrphanActionReported,
+				"daytona-target-old":          OrphanActionReported,
+				"vol-retained":                OrphanActionRetained,
+				"i-recent":                    OrphanActionReported,
+				"/daytona/targets/recent/env": OrphanActionReported,
+			},
+		},
+		{
+			name:          "Delete",
+			deleteOrphans: true,
+			want: map[string]string{
+				"i-old":                       OrphanActionDeleted,
+				"daytona-target-old":          OrphanActionDeleted,
+				"vol-retained":                OrphanActionRetained,
+				"i-recent":                    OrphanActionGracePeriod,
+				"/daytona/targets/recent/env": OrphanActionGracePeriod,
+			},
+		},
+		{
+			name:          "Dry run",
+			deleteOrphans: true,
+			dryRun:        true,
+			want: map[string]string{
+				"i-old":                       OrphanActionWouldDelete,
+				"daytona-target-old":          OrphanActionWouldDelete,
+				"vol-retained":                OrphanActionRetained,
+				"i-recent":                    OrphanActionGracePeriod,
+				"/daytona/targets/recent/env": OrphanActionGracePeriod,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orphans := planOrphanCollection(newResources(), []string{"known"}, now, time.Hour, tt.deleteOrphans, tt.dryRun)
+
+			if len(orphans) != len(tt.want) {
+				t.Fatalf("planOrphanCollection() returned %d orphans, want %d", len(orphans), len(tt.want))
+			}
+			for _, orphan := range orphans {
+				if orphan.Action != tt.want[orphan.ResourceId] {
+					t.Errorf("action of %s = %q, want %q", orphan.ResourceId, orphan.Action, tt.want[orphan.ResourceId])
+				}
+			}
+		})
+	}
+}
+
+func TestMarkFailedOrphanTargets(t *testing.T) {
+	orphans := []*Orphan{
+		{TargetId: "failed", ResourceType: OrphanResourceInstance, ResourceId: "i-failed", Action: OrphanActionDeleted},
+		{TargetId: "failed", ResourceType: OrphanResourceRole, ResourceId: "daytona-target-failed", Action: OrphanActionDeleted},
+		{TargetId: "failed", ResourceType: OrphanResourceDataVolume, ResourceId: "vol-retained", Action: OrphanActionRetained},
+		{TargetId: "terminated", ResourceType: OrphanResourceInstance, ResourceId: "i-terminated", Action: OrphanActionDeleted},
+		{TargetId: "terminated", ResourceType: OrphanResourceRole, ResourceId: "daytona-target-terminated", Action: OrphanActionDeleted},
+	}
+
+	markFailedOrphanTargets(orphans, map[string]error{"failed": errors.New("access denied")})
+
+	want := map[string]string{
+		"i-failed":                  OrphanActionFailed,
+		"daytona-target-failed":     OrphanActionSkipped,
+		"vol-retained":              OrphanActionRetained,
+		"i-terminated":              OrphanActionDeleted,
+		"daytona-target-terminated": OrphanActionDeleted,
+	}
+	for _, orphan := range orphans {
+		if orphan.Action != want[orphan.ResourceId] {
+			t.Errorf("action of %s = %q, want %q", orphan.ResourceId, orphan.Action, want[orphan.ResourceId])
+		}
+		if (orphan.Error != "") != (orphan.TargetId == "failed" && orphan.Action != OrphanActionRetained) {
+			t.Errorf("error of %s = %q", orphan.ResourceId, orphan.Error)
+		}
+	}
+}
+
+func TestGetOrphanTargetIds(t *testing.T) {
+	targetId, ok := getSecretsParameterTargetId(getSecretsParameterName("target-1"))
+	if !ok || targetId != "target-1" {
+		t.Errorf("getSecretsParameterTargetId() = %q, %v, want target-1", targetId, ok)
+	}
+	if _, ok := getSecretsParameterTargetId("/daytona/targets/target-1/other"); ok {
+		t.Errorf("getSecretsParameterTargetId() accepted a parameter that is not a secrets parameter")
+	}
+
+	for _, prefix := range []string{"", "daytona", "daytona/user-data/"} {
+		opts := &types.TargetOptions{UserDataPrefix: prefix}
+
+		targetId, ok := getUserDataTargetId(opts, getUserDataKey(opts, "target-1"))
+		if !ok || targetId != "target-1" {
+			t.Errorf("getUserDataTargetId() with prefix %q = %q, %v, want target-1", prefix, targetId, ok)
+		}
+	}
+	if _, ok := getUserDataTargetId(&types.TargetOptions{UserDataPrefix: "daytona"}, "other/target-1/user-data"); ok {
+		t.Errorf("getUserDataTargetId() accepted a key outside of the prefix")
+	}
+}
+
+func TestWriteOrphanAuditLog(t *testing.T) {
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+
+	var auditLog bytes.Buffer
+	err := writeOrphanAuditLog(&auditLog, "us-east-1", []*Orphan{
+		{TargetId: "old", ResourceType: OrphanResourceInstance, ResourceId: "i-old", Action: OrphanActionDeleted},
+		{TargetId: "old", ResourceType: OrphanResourceRole, ResourceId: "daytona-target-old", Action: OrphanActionFailed, Error: "access denied"},
+	}, now)
+	if err != nil {
+		t.Fatalf("writeOrphanAuditLog() error = %v", err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(auditLog.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("writeOrphanAuditLog() wrote %d lines, want 2", len(lines))
+	}
+
+	var entry map[string]interface{}
+	err = json.Unmarshal(lines[1], &entry)
+	if err != nil {
+		t.Fatalf("invalid audit log entry: %v", err)
+	}
+	if entry["region"] != "us-east-1" || entry["resourceId"] != "daytona-target-old" || entry["action"] != OrphanActionFailed || entry["error"] != "access denied" {
+		t.Errorf("audit log entry = %v", entry)
+	}
+}
@@ -0,0 +1,208 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+// ErrNoDataVolume is returned when recreating a target without a data volume,
+// which would lose its workspaces
+var ErrNoDataVolume = errors.New("target has no data volume")
+
+// RecreateTarget replaces the instance of a target with a new instance
+// launched with the current target options, e.g. a new image or instance type.
+// The data volume is detached from the old instance and attached to the new
+// one, whose bootstrap mounts it again without formatting it. The launch is
+// validated before the old instance is terminated. If the new instance fails
+// to launch, it is rolled back and the data volume is kept, along with the
+// expiry of the target, for the next attempt.
+//
+// RecreateTarget is not part of the provider plugin interface, see
+// AWSProvider.RecreateTarget.
+func RecreateTarget(target *models.Target, opts *types.TargetOptions, initScript string, logWriter io.Writer) error {
+	sess, err := getSession(opts, target.Id)
+	if err != nil {
+		return err
+	}
+
+	client := ec2.New(sess)
+
+	dataVolume, err := getDataVolume(client, target.Id)
+	if err != nil {
+		return err
+	}
+	if dataVolume == nil || opts.DataVolumeSize == 0 {
+		return fmt.Errorf("%w, recreating its instance would lose its workspaces", ErrNoDataVolume)
+	}
+
+	instances, err := listInstancesByWorkspaceID(client, target.Id)
+	if err != nil {
+		return err
+	}
+
+	// The new instance keeps the expiry of the target, recreating a target does
+	// not extend its lifetime. If a previous attempt already terminated the old
+	// instance, the expiry is read from the data volume
+	var expiresAt time.Time
+	if len(instances) == 0 {
+		expiresAt, err = getTagsExpiry(dataVolume.Tags, "data volume "+*dataVolume.VolumeId)
+		if err != nil {
+			return err
+		}
+
+		err = checkExpiresAt(expiresAt, "data volume "+*dataVolume.VolumeId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, instance := range instances {
+		err = checkExpiry(instance)
+		if err != nil {
+			return err
+		}
+
+		expiresAt, err = GetExpiry(instance)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Nothing is stopped or terminated unless the new instance can be launched
+	// next to the data volume
+	err = validateRecreate(sess, client, opts, dataVolume, logWriter)
+	if err != nil {
+		return err
+	}
+
+	if !expiresAt.IsZero() {
+		err = setExpiry(client, dataVolume.VolumeId, expiresAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	// The instance is stopped first so that the file system of the data volume
+	// is cleanly unmounted before the volume is detached
+	for _, instance := range instances {
+		if *instance.State.Name == ec2.InstanceStateNameStopped {
+			continue
+		}
+
+		logWriter.Write([]byte(fmt.Sprintf("Stopping instance %s\n", *instance.InstanceId)))
+		_, err = client.StopInstances(&ec2.StopInstancesInput{
+			InstanceIds: []*string{instance.InstanceId},
+		})
+		if err != nil {
+			return err
+		}
+
+		err = client.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{instance.InstanceId},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = detachDataVolume(client, dataVolume)
+	if err != nil {
+		return err
+	}
+
+	logWriter.Write([]byte("Terminating the old instance\n"))
+	err = terminateInstances(client, instances)
+	if err != nil {
+		return err
+	}
+
+	logWriter.Write([]byte("Launching the new instance\n"))
+	err = CreateTarget(target, opts, initScript, logWriter)
+	if err != nil {
+		// The old instance is gone, so the new one is rolled back while the data
+		// volume is kept for the next attempt
+		rollbackErr := RollbackRecreatedTarget(target, opts)
+		if rollbackErr != nil {
+			logWriter.Write([]byte(fmt.Sprintf("Failed to roll back the new instance: %s\n", rollbackErr.Error())))
+		}
+		return err
+	}
+
+	if expiresAt.IsZero() {
+		return nil
+	}
+
+	instance, err := getInstanceByWorkspaceID(client, target.Id)
+	if err != nil {
+		return err
+	}
+
+	return setExpiry(client, instance.InstanceId, expiresAt)
+}
+
+// validateRecreate checks that a new instance can be launched with the target
+// options in the availability zone of the data volume: the image resolves, the
+// KMS key is usable, the instance type is offered in the zone and a subnet is
+// in it.
+func validateRecreate(sess *session.Session, client *ec2.EC2, opts *types.TargetOptions, dataVolume *ec2.Volume, logWriter io.Writer) error {
+	_, err := resolveImage(sess, opts)
+	if err != nil {
+		return err
+	}
+
+	warning, err := checkKmsKey(sess, opts)
+	if err != nil {
+		return err
+	}
+	if warning != "" {
+		logWriter.Write([]byte("Warning: " + warning + "\n"))
+	}
+
+	availabilityZone := *dataVolume.AvailabilityZone
+	offered, err := isInstanceTypeOffered(client, opts.InstanceType, ec2.LocationTypeAvailabilityZone, availabilityZone)
+	if err != nil {
+		return err
+	}
+	if !offered {
+		return fmt.Errorf("instance type %s is not offered in availability zone %s of the data volume", opts.InstanceType, availabilityZone)
+	}
+
+	subnets, err := getSubnets(client, opts)
+	if err != nil {
+		return err
+	}
+
+	err = validateSecurityGroups(client, opts, subnets)
+	if err != nil {
+		return err
+	}
+
+	_, err = placeInAvailabilityZone(&ec2.RunInstancesInput{}, subnets, availabilityZone)
+	return err
+}
+
+// detachDataVolume detaches the data volume from the instance it is attached
+// to, if any.
+func detachDataVolume(client *ec2.EC2, volume *ec2.Volume) error {
+	if len(volume.Attachments) == 0 {
+		return nil
+	}
+
+	_, err := client.DetachVolume(&ec2.DetachVolumeInput{
+		VolumeId: volume.VolumeId,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to detach data volume %s: %w", aws.StringValue(volume.VolumeId), err)
+	}
+
+	return client.WaitUntilVolumeAvailable(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{volume.VolumeId},
+	})
+}
@@ -0,0 +1,300 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/servicequotas"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/provider"
+)
+
+const (
+	RequirementCredentials  = "AWS credentials"
+	RequirementRegion       = "AWS region"
+	RequirementImage        = "Machine image"
+	RequirementInstanceType = "Instance type"
+	RequirementVCpuQuota    = "vCPU quota"
+	RequirementPermissions  = "IAM permissions"
+	RequirementKmsKey       = "KMS key"
+
+	// requirementsCheckTargetId is the target id used to check the requirements
+	// when no target is involved, e.g. in the tags of the dry run launch
+	requirementsCheckTargetId = "requirements-check"
+)
+
+// vCpuQuotaCodes maps an instance family class to the codes of its on-demand
+// and spot vCPU quotas.
+// https://docs.aws.amazon.com/ec2/latest/instancetypes/ec2-instance-quotas.html
+var vCpuQuotaCodes = map[string]struct {
+	OnDemand string
+	Spot     string
+}{
+	"standard": {OnDemand: "L-1216C47A", Spot: "L-34B43A08"},
+	"f":        {OnDemand: "L-74FC7D96", Spot: "L-88CF9481"},
+	"g":        {OnDemand: "L-DB2E81BA", Spot: "L-3819A6DF"},
+	"inf":      {OnDemand: "L-1945791B", Spot: "L-B5D1601B"},
+	"p":        {OnDemand: "L-417A185B", Spot: "L-7212CCBC"},
+	"x":        {OnDemand: "L-7295265B", Spot: "L-E3A00192"},
+}
+
+// CheckRequirements checks that targets can be created with the given target
+// options: the credentials are valid, the region is reachable, the image and
+// instance type are available and compatible, the vCPU quota is not exceeded,
+// the KMS key of the volumes is usable and the credentials are allowed to
+// launch instances.
+// Checks that depend on a failed check are reported as not met.
+func CheckRequirements(opts *types.TargetOptions) []provider.RequirementStatus {
+	results := []provider.RequirementStatus{}
+
+	// The KMS key is only checked if it is used
+	var kmsRequirements []string
+	if opts.KmsKeyId != "" {
+		kmsRequirements = append(kmsRequirements, RequirementKmsKey)
+	}
+
+	sess, err := getSession(opts, "")
+	if err == nil {
+		err = checkCredentials(sess)
+	}
+	results = append(results, getRequirementStatus(RequirementCredentials, err))
+	if err != nil {
+		return append(results, skipRequirements(RequirementCredentials, append([]string{
+			RequirementRegion, RequirementImage, RequirementInstanceType, RequirementVCpuQuota, RequirementPermissions}, kmsRequirements...)...)...)
+	}
+
+	client := ec2.New(sess)
+
+	err = checkRegion(client, opts)
+	results = append(results, getRequirementStatus(RequirementRegion, err))
+	if err != nil {
+		return append(results, skipRequirements(RequirementRegion, append([]string{
+			RequirementImage, RequirementInstanceType, RequirementVCpuQuota, RequirementPermissions}, kmsRequirements...)...)...)
+	}
+
+	if opts.KmsKeyId != "" {
+		results = append(results, getKmsKeyRequirementStatus(RequirementKmsKey, sess, opts))
+	}
+
+	instanceTypeInfo, err := checkInstanceType(client, opts)
+	results = append(results, getRequirementStatus(RequirementInstanceType, err))
+
+	image, err := resolveImage(sess, opts)
+	if err == nil && instanceTypeInfo != nil && !supportsArchitecture(instanceTypeInfo, aws.StringValue(image.Architecture)) {
+		err = fmt.Errorf("image %s is built for %s, which instance type %s does not support", *image.ImageId, aws.StringValue(image.Architecture), opts.InstanceType)
+	}
+	results = append(results, getRequirementStatus(RequirementImage, err))
+
+	if instanceTypeInfo == nil {
+		results = append(results, skipRequirements(RequirementInstanceType, RequirementVCpuQuota)...)
+	} else {
+		results = append(results, checkVCpuQuota(sess, client, opts, instanceTypeInfo))
+	}
+
+	if image == nil {
+		results = append(results, skipRequirements(RequirementImage, RequirementPermissions)...)
+	} else {
+		results = append(results, getRequirementStatus(RequirementPermissions, checkPermissions(client, opts, image)))
+	}
+
+	return results
+}
+
+func checkCredentials(sess *session.Session) error {
+	_, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	return err
+}
+
+func checkRegion(client *ec2.EC2, opts *types.TargetOptions) error {
+	result, err := client.DescribeRegions(&ec2.DescribeRegionsInput{
+		RegionNames: []*string{aws.String(opts.Region)},
+	})
+	if err != nil {
+		return fmt.Errorf("region %s not reachable: %w", opts.Region, err)
+	}
+
+	if len(result.Regions) == 0 || aws.StringValue(result.Regions[0].OptInStatus) == "not-opted-in" {
+		return fmt.Errorf("region %s is not enabled for the account", opts.Region)
+	}
+
+	return nil
+}
+
+func checkInstanceType(client *ec2.EC2, opts *types.TargetOptions) (*ec2.InstanceTypeInfo, error) {
+	offered, err := isInstanceTypeOffered(client, opts.InstanceType, ec2.LocationTypeRegion, opts.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	if !offered {
+		return nil, fmt.Errorf("instance type %s is not offered in region %s", opts.InstanceType, opts.Region)
+	}
+
+	return getInstanceTypeInfo(client, opts.InstanceType)
+}
+
+// checkVCpuQuota checks that launching an instance of the configured type
+// does not exceed the vCPU quota of its instance family class.
+func checkVCpuQuota(sess *session.Session, client *ec2.EC2, opts *types.TargetOptions, instanceTypeInfo *ec2.InstanceTypeInfo) provider.RequirementStatus {
+	instanceClass := getInstanceClass(opts.InstanceType)
+	quotaCodes, ok := vCpuQuotaCodes[instanceClass]
+	if !ok {
+		return provider.RequirementStatus{
+			Name:   RequirementVCpuQuota,
+			Met:    true,
+			Reason: fmt.Sprintf("vCPU quota is not checked for instance type %s", opts.InstanceType),
+		}
+	}
+
+	spot := opts.PurchasingOption == types.PurchasingOptionSpot || opts.PurchasingOption == types.PurchasingOptionSpotWithFallback
+	quotaCode := quotaCodes.OnDemand
+	if spot {
+		quotaCode = quotaCodes.Spot
+	}
+
+	quota, err := servicequotas.New(sess).GetServiceQuota(&servicequotas.GetServiceQuotaInput{
+		ServiceCode: aws.String("ec2"),
+		QuotaCode:   aws.String(quotaCode),
+	})
+	if err != nil {
+		return getRequirementStatus(RequirementVCpuQuota, fmt.Errorf("failed to get vCPU quota %s: %w", quotaCode, err))
+	}
+
+	usedVCpus, err := getUsedVCpus(client, instanceClass, spot)
+	if err != nil {
+		return getRequirementStatus(RequirementVCpuQuota, fmt.Errorf("failed to get vCPU usage: %w", err))
+	}
+
+	limit := int64(aws.Float64Value(quota.Quota.Value))
+	requiredVCpus := aws.Int64Value(instanceTypeInfo.VCpuInfo.DefaultVCpus)
+	if usedVCpus+requiredVCpus > limit {
+		return provider.RequirementStatus{
+			Name: RequirementVCpuQuota,
+			Met:  false,
+			Reason: fmt.Sprintf("%d of %d vCPUs of quota %s are in use, instance type %s requires %d more",
+				usedVCpus, limit, quotaCode, opts.InstanceType, requiredVCpus),
+		}
+	}
+
+	return provider.RequirementStatus{
+		Name:   RequirementVCpuQuota,
+		Met:    true,
+		Reason: fmt.Sprintf("%d of %d vCPUs of quota %s are in use", usedVCpus, limit, quotaCode),
+	}
+}
+
+// getUsedVCpus sums the vCPUs of the running instances of an instance family
+// class and market type.
+func getUsedVCpus(client *ec2.EC2, instanceClass string, spot bool) (int64, error) {
+	var usedVCpus int64
+	err := client.DescribeInstancesPages(&ec2.DescribeInstancesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: aws.StringSlice([]string{ec2.InstanceStateNamePending, ec2.InstanceStateNameRunning}),
+			},
+		},
+	}, func(page *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				if getInstanceClass(aws.StringValue(instance.InstanceType)) != instanceClass {
+					continue
+				}
+				if (GetMarketType(instance) == MarketTypeSpot) != spot {
+					continue
+				}
+				if instance.CpuOptions != nil {
+					usedVCpus += aws.Int64Value(instance.CpuOptions.CoreCount) * aws.Int64Value(instance.CpuOptions.ThreadsPerCore)
+				}
+			}
+		}
+		return true
+	})
+
+	return usedVCpus, err
+}
+
+// getInstanceClass returns the vCPU quota class of an instance type.
+func getInstanceClass(instanceType string) string {
+	family, _, _ := strings.Cut(instanceType, ".")
+
+	switch {
+	case strings.HasPrefix(family, "inf"):
+		return "inf"
+	case strings.HasPrefix(family, "vt"):
+		return "g"
+	case strings.HasPrefix(family, "dl"), strings.HasPrefix(family, "trn"), strings.HasPrefix(family, "hpc"),
+		strings.HasPrefix(family, "mac"), strings.HasPrefix(family, "u-"):
+		return family
+	}
+
+	if family == "" {
+		return ""
+	}
+
+	switch family[0] {
+	case 'a', 'c', 'd', 'h', 'i', 'm', 'r', 't', 'z':
+		return "standard"
+	case 'f', 'g', 'p', 'x':
+		return family[:1]
+	}
+
+	return family
+}
+
+// checkPermissions checks that the credentials are allowed to launch an
+// instance with the configured options, using a dry run launch.
+func checkPermissions(client *ec2.EC2, opts *types.TargetOptions, image *ec2.Image) error {
+	subnets, err := getSubnets(client, opts)
+	if err != nil {
+		return err
+	}
+
+	input := getRunInstancesInput(requirementsCheckTargetId, opts, image, "")
+	input.UserData = nil
+	input.DryRun = aws.Bool(true)
+
+	_, err = runInstances(client, input, opts, subnets, "")
+	if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == "DryRunOperation" {
+		return nil
+	}
+	if err == nil {
+		return fmt.Errorf("unexpected result of the dry run launch")
+	}
+
+	return err
+}
+
+func getRequirementStatus(name string, err error) provider.RequirementStatus {
+	if err != nil {
+		return provider.RequirementStatus{
+			Name:   name,
+			Met:    false,
+			Reason: err.Error(),
+		}
+	}
+
+	return provider.RequirementStatus{
+		Name: name,
+		Met:  true,
+	}
+}
+
+// skipRequirements reports the given requirements as not met because the
+// requirement they depend on is not met.
+func skipRequirements(dependency string, names ...string) []provider.RequirementStatus {
+	var results []provider.RequirementStatus
+	for _, name := range names {
+		results = append(results, provider.RequirementStatus{
+			Name:   name,
+			Met:    false,
+			Reason: fmt.Sprintf("Not checked, requirement %q is not met", dependency),
+		})
+	}
+	return results
+}
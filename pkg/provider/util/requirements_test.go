@@ -0,0 +1,23 @@
+package util
+
+import "testing"
+
+func TestGetInstanceClass(t *testing.T) {
+	tests := map[string]string{
+		"t2.micro":       "standard",
+		"m7g.large":      "standard",
+		"g5.xlarge":      "g",
+		"vt1.3xlarge":    "g",
+		"p4d.24xlarge":   "p",
+		"inf2.xlarge":    "inf",
+		"x2idn.16xlarge": "x",
+		"trn1.2xlarge":   "trn1",
+	}
+
+	for instanceType, want := range tests {
+		got := getInstanceClass(instanceType)
+		if got != want {
+			t.Errorf("getInstanceClass(%s) = %s, want %s", instanceType, got, want)
+		}
+	}
+}
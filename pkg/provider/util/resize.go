@@ -0,0 +1,202 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+// ErrUnsupportedInstanceTypeChange is returned if the instance of a target
+// cannot be changed to the instance type of the target options
+var ErrUnsupportedInstanceTypeChange = errors.New("unsupported instance type change")
+
+// ResizeTarget changes the instance type of a target to the instance type of
+// the target options. A running instance is stopped, resized and started again.
+func ResizeTarget(target *models.Target, opts *types.TargetOptions, logWriter io.Writer) error {
+	client, err := getEC2Client(opts, target.Id)
+	if err != nil {
+		return err
+	}
+
+	instance, err := getInstanceByWorkspaceID(client, target.Id)
+	if err != nil {
+		return err
+	}
+
+	if !needsResize(instance, opts) {
+		logWriter.Write([]byte(fmt.Sprintf("Instance is already of type %s\n", opts.InstanceType)))
+		return nil
+	}
+
+	state := *instance.State.Name
+	wasRunning := state == ec2.InstanceStateNameRunning || state == ec2.InstanceStateNamePending
+
+	err = resizeInstance(client, instance, opts, logWriter)
+	if err != nil {
+		return err
+	}
+
+	if !wasRunning {
+		return nil
+	}
+
+	_, err = client.StartInstances(&ec2.StartInstancesInput{
+		InstanceIds: []*string{instance.InstanceId},
+	})
+	if err != nil {
+		return err
+	}
+
+	return client.WaitUntilInstanceRunning(&ec2.DescribeInstancesInput{
+		InstanceIds: []*string{instance.InstanceId},
+	})
+}
+
+// needsResize returns true if the instance type of the instance differs from
+// the instance type of the target options.
+func needsResize(instance *ec2.Instance, opts *types.TargetOptions) bool {
+	return opts.InstanceType != "" && aws.StringValue(instance.InstanceType) != opts.InstanceType
+}
+
+// resizeInstance checks that the instance can run on the instance type of the
+// target options, then stops the instance and changes its type. The instance
+// is left stopped.
+func resizeInstance(client *ec2.EC2, instance *ec2.Instance, opts *types.TargetOptions, logWriter io.Writer) error {
+	err := checkInstanceTypeChange(client, instance, opts.InstanceType, logWriter)
+	if err != nil {
+		return fmt.Errorf("cannot change instance type from %s to %s: %w", *instance.InstanceType, opts.InstanceType, err)
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("Changing instance type from %s to %s\n", *instance.InstanceType, opts.InstanceType)))
+
+	switch *instance.State.Name {
+	case ec2.InstanceStateNameRunning, ec2.InstanceStateNamePending:
+		_, err = client.StopInstances(&ec2.StopInstancesInput{
+			InstanceIds: []*string{instance.InstanceId},
+		})
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case ec2.InstanceStateNameStopping:
+		err = client.WaitUntilInstanceStopped(&ec2.DescribeInstancesInput{
+			InstanceIds: []*string{instance.InstanceId},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = client.ModifyInstanceAttribute(&ec2.ModifyInstanceAttributeInput{
+		InstanceId: instance.InstanceId,
+		InstanceType: &ec2.AttributeValue{
+			Value: aws.String(opts.InstanceType),
+		},
+	})
+	return err
+}
+
+// checkInstanceTypeChange checks that the instance can be changed to the given
+// instance type in its availability zone. Changes the instance does not
+// support are refused with ErrUnsupportedInstanceTypeChange.
+func checkInstanceTypeChange(client *ec2.EC2, instance *ec2.Instance, instanceType string, logWriter io.Writer) error {
+	if GetMarketType(instance) == MarketTypeSpot {
+		return fmt.Errorf("%w: the instance type of spot instances cannot be changed, recreate the target instead", ErrUnsupportedInstanceTypeChange)
+	}
+
+	currentInfo, err := getInstanceTypeInfo(client, *instance.InstanceType)
+	if err != nil {
+		return err
+	}
+
+	nextInfo, err := getInstanceTypeInfo(client, instanceType)
+	if err != nil {
+		return err
+	}
+
+	err = validateInstanceTypeChange(instance, currentInfo, nextInfo)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnsupportedInstanceTypeChange, err)
+	}
+
+	// The image may be deregistered since the instance was launched, in which
+	// case its drivers are unknown
+	image, _ := getImageById(client, aws.StringValue(instance.ImageId), "")
+	if warning := getNvmeDriverWarning(instance, image, currentInfo, nextInfo); warning != "" {
+		logWriter.Write([]byte("Warning: " + warning + "\n"))
+	}
+
+	availabilityZone := aws.StringValue(instance.Placement.AvailabilityZone)
+	offered, err := isInstanceTypeOffered(client, instanceType, ec2.LocationTypeAvailabilityZone, availabilityZone)
+	if err != nil {
+		return err
+	}
+	if !offered {
+		return fmt.Errorf("%w: instance type %s is not offered in availability zone %s", ErrUnsupportedInstanceTypeChange, instanceType, availabilityZone)
+	}
+
+	return nil
+}
+
+// validateInstanceTypeChange validates that the instance, launched on the
+// current instance type, can boot on the next instance type.
+// https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/resize-limitations.html
+func validateInstanceTypeChange(instance *ec2.Instance, current, next *ec2.InstanceTypeInfo) error {
+	if isHibernationConfigured(instance) {
+		return fmt.Errorf("the instance type of instances enabled for hibernation cannot be changed, recreate the target instead")
+	}
+
+	architecture := aws.StringValue(instance.Architecture)
+	if !supportsArchitecture(next, architecture) {
+		return fmt.Errorf("instance type %s does not support the %s architecture of the instance", *next.InstanceType, architecture)
+	}
+
+	if next.NetworkInfo != nil && aws.StringValue(next.NetworkInfo.EnaSupport) == ec2.EnaSupportRequired && !aws.BoolValue(instance.EnaSupport) {
+		return fmt.Errorf("instance type %s requires ENA, which is not enabled on the instance", *next.InstanceType)
+	}
+
+	bootMode := aws.StringValue(instance.CurrentInstanceBootMode)
+	if bootMode != "" && len(next.SupportedBootModes) > 0 && !containsString(next.SupportedBootModes, bootMode) {
+		return fmt.Errorf("instance type %s does not support the %s boot mode of the instance", *next.InstanceType, bootMode)
+	}
+
+	return nil
+}
+
+// getNvmeDriverWarning returns a warning if the instance moves from a Xen to a
+// Nitro instance type, which requires NVMe, and neither the instance nor its
+// image declare ENA support. Images that support ENA, such as the default
+// Ubuntu image, also ship the NVMe driver, while older images may miss it and
+// fail to boot.
+func getNvmeDriverWarning(instance *ec2.Instance, image *ec2.Image, current, next *ec2.InstanceTypeInfo) string {
+	if getNvmeSupport(next) != ec2.EbsNvmeSupportRequired || getNvmeSupport(current) != ec2.EbsNvmeSupportUnsupported {
+		return ""
+	}
+
+	if aws.BoolValue(instance.EnaSupport) || (image != nil && aws.BoolValue(image.EnaSupport)) {
+		return ""
+	}
+
+	return fmt.Sprintf("instance type %s requires NVMe, the image of the instance may not have the NVMe driver, recreate the target if it fails to start", *next.InstanceType)
+}
+
+func getNvmeSupport(instanceTypeInfo *ec2.InstanceTypeInfo) string {
+	if instanceTypeInfo.EbsInfo == nil {
+		return ""
+	}
+	return aws.StringValue(instanceTypeInfo.EbsInfo.NvmeSupport)
+}
+
+func containsString(values []*string, value string) bool {
+	for _, v := range values {
+		if aws.StringValue(v) == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+func getTestInstanceTypeInfo(instanceType, architecture, enaSupport, nvmeSupport string, bootModes ...string) *ec2.InstanceTypeInfo {
+	return &ec2.InstanceTypeInfo{
+		InstanceType: aws.String(instanceType),
+		ProcessorInfo: &ec2.ProcessorInfo{
+			SupportedArchitectures: aws.StringSlice([]string{architecture}),
+		},
+		NetworkInfo: &ec2.NetworkInfo{
+			EnaSupport: aws.String(enaSupport),
+		},
+		EbsInfo: &ec2.EbsInfo{
+			NvmeSupport: aws.String(nvmeSupport),
+		},
+		SupportedBootModes: aws.StringSlice(bootModes),
+	}
+}
+
+func TestValidateInstanceTypeChange(t *testing.T) {
+	t2Micro := getTestInstanceTypeInfo("t2.micro", "x86_64", "unsupported", "unsupported", "legacy-bios")
+	t3Large := getTestInstanceTypeInfo("t3.large", "x86_64", "required", "required", "legacy-bios", "uefi")
+	m7iLarge := getTestInstanceTypeInfo("m7i.large", "x86_64", "required", "required", "legacy-bios", "uefi")
+	m7gLarge := getTestInstanceTypeInfo("m7g.large", "arm64", "required", "required", "uefi")
+
+	nitroInstance := &ec2.Instance{
+		Architecture:            aws.String("x86_64"),
+		EnaSupport:              aws.Bool(true),
+		CurrentInstanceBootMode: aws.String("legacy-bios"),
+	}
+
+	tests := []struct {
+		name     string
+		instance *ec2.Instance
+		current  *ec2.InstanceTypeInfo
+		next     *ec2.InstanceTypeInfo
+		wantErr  bool
+	}{
+		{name: "Same architecture on Nitro", instance: nitroInstance, current: t3Large, next: m7iLarge},
+		{name: "Different architecture", instance: nitroInstance, current: t3Large, next: m7gLarge, wantErr: true},
+		{
+			name:     "ENA required but not enabled",
+			instance: &ec2.Instance{Architecture: aws.String("x86_64"), EnaSupport: aws.Bool(false)},
+			current:  t2Micro,
+			next:     t3Large,
+			wantErr:  true,
+		},
+		{name: "Xen to Nitro", instance: nitroInstance, current: t2Micro, next: t3Large},
+		{name: "Nitro to Xen", instance: nitroInstance, current: t3Large, next: t2Micro},
+		{
+			name:     "Hibernation enabled",
+			instance: &ec2.Instance{Architecture: aws.String("x86_64"), EnaSupport: aws.Bool(true), HibernationOptions: &ec2.HibernationOptions{Configured: aws.Bool(true)}},
+			current:  t3Large,
+			next:     m7iLarge,
+			wantErr:  true,
+		},
+		{
+			name:     "Unsupported boot mode",
+			instance: &ec2.Instance{Architecture: aws.String("x86_64"), EnaSupport: aws.Bool(true), CurrentInstanceBootMode: aws.String("uefi")},
+			current:  t3Large,
+			next:     t2Micro,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInstanceTypeChange(tt.instance, tt.current, tt.next)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateInstanceTypeChange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetNvmeDriverWarning(t *testing.T) {
+	t2Micro := getTestInstanceTypeInfo("t2.micro", "x86_64", "unsupported", "unsupported", "legacy-bios")
+	t3Large := getTestInstanceTypeInfo("t3.large", "x86_64", "required", "required", "legacy-bios", "uefi")
+	m7iLarge := getTestInstanceTypeInfo("m7i.large", "x86_64", "required", "required", "legacy-bios", "uefi")
+
+	withoutEna := &ec2.Instance{EnaSupport: aws.Bool(false)}
+
+	tests := []struct {
+		name        string
+		instance    *ec2.Instance
+		image       *ec2.Image
+		current     *ec2.InstanceTypeInfo
+		next        *ec2.InstanceTypeInfo
+		wantWarning bool
+	}{
+		{name: "ENA enabled on the instance", instance: &ec2.Instance{EnaSupport: aws.Bool(true)}, current: t2Micro, next: t3Large},
+		{name: "ENA supported by the image", instance: withoutEna, image: &ec2.Image{EnaSupport: aws.Bool(true)}, current: t2Micro, next: t3Large},
+		{name: "Drivers unknown", instance: withoutEna, current: t2Micro, next: t3Large, wantWarning: true},
+		{name: "Nitro to Nitro", instance: withoutEna, current: t3Large, next: m7iLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warning := getNvmeDriverWarning(tt.instance, tt.image, tt.current, tt.next)
+			if (warning != "") != tt.wantWarning {
+				t.Errorf("getNvmeDriverWarning() = %q, wantWarning %v", warning, tt.wantWarning)
+			}
+		})
+	}
+}
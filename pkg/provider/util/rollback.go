@@ -0,0 +1,90 @@
+package util
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+const (
+	StatusTagKey        = "DaytonaStatus"
+	FailureReasonTagKey = "DaytonaFailureReason"
+	StatusFailed        = "failed"
+
+	maxTagValueLen = 256
+)
+
+// RollbackTarget removes the resources created for a target whose creation
+// failed. The creation may have failed before or while the instance was
+// launched, so no instance may exist. The data volume holds no data yet, so
+// it is deleted regardless of its deletion policy.
+func RollbackTarget(target *models.Target, opts *types.TargetOptions) error {
+	return deleteTarget(target, opts, true)
+}
+
+// RollbackRecreatedTarget removes the resources created for a target whose
+// instance failed to be recreated. The data volume holds the workspaces of
+// the target, so it is always kept and the target can be recreated again.
+func RollbackRecreatedTarget(target *models.Target, opts *types.TargetOptions) error {
+	return deleteTarget(target, opts, false)
+}
+
+// MarkTargetFailed tags the instances of a target whose creation failed, so
+// they can be found and inspected instead of being rolled back.
+func MarkTargetFailed(target *models.Target, opts *types.TargetOptions, reason error) error {
+	client, err := getEC2Client(opts, target.Id)
+	if err != nil {
+		return err
+	}
+
+	instances, err := listInstancesByWorkspaceID(client, target.Id)
+	if err != nil {
+		return err
+	}
+
+	if len(instances) == 0 {
+		return fmt.Errorf("no instance found for target %s", target.Id)
+	}
+
+	var instanceIds []*string
+	for _, instance := range instances {
+		instanceIds = append(instanceIds, instance.InstanceId)
+	}
+
+	failureReason := truncateTagValue(reason.Error())
+
+	_, err = client.CreateTags(&ec2.CreateTagsInput{
+		Resources: instanceIds,
+		Tags: []*ec2.Tag{
+			{
+				Key:   aws.String(StatusTagKey),
+				Value: aws.String(StatusFailed),
+			},
+			{
+				Key:   aws.String(FailureReasonTagKey),
+				Value: aws.String(failureReason),
+			},
+		},
+	})
+	return err
+}
+
+// truncateTagValue truncates the value to the maximum length of a tag value,
+// without splitting a multi-byte character, which EC2 would refuse as invalid
+// UTF-8.
+func truncateTagValue(value string) string {
+	if len(value) <= maxTagValueLen {
+		return value
+	}
+
+	end := maxTagValueLen
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+
+	return value[:end]
+}
@@ -0,0 +1,28 @@
+package util
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateTagValue(t *testing.T) {
+	tests := map[string]struct {
+		value   string
+		wantLen int
+	}{
+		"Short":               {value: "instance launch failed", wantLen: 22},
+		"ASCII":               {value: strings.Repeat("a", 300), wantLen: maxTagValueLen},
+		"Multi-byte boundary": {value: strings.Repeat("a", maxTagValueLen-1) + "é", wantLen: maxTagValueLen - 1},
+		"Multi-byte":          {value: strings.Repeat("日本", 100), wantLen: 255},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := truncateTagValue(tt.value)
+			if len(got) != tt.wantLen || !utf8.ValidString(got) || !strings.HasPrefix(tt.value, got) {
+				t.Errorf("truncateTagValue() = %d bytes, valid UTF-8 %v, want a %d bytes prefix", len(got), utf8.ValidString(got), tt.wantLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+const (
+	secretsParameterPrefix = "/daytona/targets"
+	targetRoleNamePrefix   = "daytona-target-"
+	targetRolePolicyName   = "daytona-target-secrets"
+	maxRoleNameLen         = 64
+
+	// New instance profiles take a few seconds to become usable by EC2
+	instanceProfileRetries       = 24
+	instanceProfileRetryInterval = 5 * time.Second
+)
+
+// getSecretsParameterName returns the name of the SSM parameter holding the
+// env vars of a target.
+func getSecretsParameterName(targetId string) string {
+	return fmt.Sprintf("%s/%s/env", secretsParameterPrefix, targetId)
+}
+
+// getTargetRoleName returns the name of the IAM role, and instance profile,
+// that grants the instance of a target access to its secrets.
+func getTargetRoleName(targetId string) string {
+	roleName := targetRoleNamePrefix + invalidRoleSessionNameChars.ReplaceAllString(targetId, "-")
+	if len(roleName) > maxRoleNameLen {
+		return roleName[:maxRoleNameLen]
+	}
+	return roleName
+}
+
+// storeTargetSecrets stores the env file of a target in an encrypted
+// SecureString SSM parameter scoped to the target.
+func storeTargetSecrets(sess *session.Session, targetId, envFile string) error {
+	client := ssm.New(sess)
+	parameterName := getSecretsParameterName(targetId)
+
+	_, err := client.PutParameter(&ssm.PutParameterInput{
+		Name:        aws.String(parameterName),
+		Description: aws.String(fmt.Sprintf("Environment of Daytona target %s", targetId)),
+		Type:        aws.String(ssm.ParameterTypeSecureString),
+		Value:       aws.String(envFile),
+		// Parameters larger than 4 KB are stored in the advanced tier
+		Tier:      aws.String(ssm.ParameterTierIntelligentTiering),
+		Overwrite: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store target secrets in SSM parameter %s: %w", parameterName, err)
+	}
+
+	_, err = client.AddTagsToResource(&ssm.AddTagsToResourceInput{
+		ResourceType: aws.String(ssm.ResourceTypeForTaggingParameter),
+		ResourceId:   aws.String(parameterName),
+		Tags: []*ssm.Tag{
+			{
+				Key:   aws.String("WorkspaceID"),
+				Value: aws.String(targetId),
+			},
+		},
+	})
+	return err
+}
+
+// createTargetInstanceProfile creates the IAM role and instance profile of a
+// target, which only grant access to the secrets of that target.
+// Existing roles and instance profiles are reused.
+func createTargetInstanceProfile(sess *session.Session, opts *types.TargetOptions, targetId string) (string, error) {
+	client := iam.New(sess)
+	roleName := getTargetRoleName(targetId)
+
+	assumeRolePolicy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":    "Allow",
+				"Principal": map[string]string{"Service": "ec2.amazonaws.com"},
+				"Action":    "sts:AssumeRole",
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = client.CreateRole(&iam.CreateRoleInput{
+		RoleName:                 aws.String(roleName),
+		Description:              aws.String(fmt.Sprintf("Instance role of Daytona target %s", targetId)),
+		AssumeRolePolicyDocument: aws.String(string(assumeRolePolicy)),
+		Tags: []*iam.Tag{
+			{
+				Key:   aws.String("WorkspaceID"),
+				Value: aws.String(targetId),
+			},
+		},
+	})
+	if err != nil && !isAwsErrorCode(err, iam.ErrCodeEntityAlreadyExistsException) {
+		return "", fmt.Errorf("failed to create role %s: %w", roleName, err)
+	}
+
+	rolePolicy, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{
+			{
+				"Effect":   "Allow",
+				"Action":   "ssm:GetParameter",
+				"Resource": getSecretsParameterArn(opts.Region, targetId),
+			},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = client.PutRolePolicy(&iam.PutRolePolicyInput{
+		RoleName:       aws.String(roleName),
+		PolicyName:     aws.String(targetRolePolicyName),
+		PolicyDocument: aws.String(string(rolePolicy)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to put policy of role %s: %w", roleName, err)
+	}
+
+	_, err = client.CreateInstanceProfile(&iam.CreateInstanceProfileInput{
+		InstanceProfileName: aws.String(roleName),
+		Tags: []*iam.Tag{
+			{
+				Key:   aws.String("WorkspaceID"),
+				Value: aws.String(targetId),
+			},
+		},
+	})
+	if err != nil && !isAwsErrorCode(err, iam.ErrCodeEntityAlreadyExistsException) {
+		return "", fmt.Errorf("failed to create instance profile %s: %w", roleName, err)
+	}
+
+	_, err = client.AddRoleToInstanceProfile(&iam.AddRoleToInstanceProfileInput{
+		InstanceProfileName: aws.String(roleName),
+		RoleName:            aws.String(roleName),
+	})
+	// An instance profile can only contain one role, so the role was already added
+	if err != nil && !isAwsErrorCode(err, iam.ErrCodeLimitExceededException) {
+		return "", fmt.Errorf("failed to add role to instance profile %s: %w", roleName, err)
+	}
+
+	return roleName, nil
+}
+
+// deleteTargetSecrets deletes the SSM parameter, IAM role and instance profile
+// of a target. Resources that do not exist are skipped.
+func deleteTargetSecrets(sess *session.Session, targetId string) error {
+	err := deleteSecretsParameter(sess, getSecretsParameterName(targetId))
+	if err != nil {
+		return err
+	}
+
+	return deleteTargetRole(sess, getTargetRoleName(targetId))
+}
+
+// deleteSecretsParameter deletes the SSM parameter, if it exists.
+func deleteSecretsParameter(sess *session.Session, parameterName string) error {
+	_, err := ssm.New(sess).DeleteParameter(&ssm.DeleteParameterInput{
+		Name: aws.String(parameterName),
+	})
+	if err != nil && !isAwsErrorCode(err, ssm.ErrCodeParameterNotFound) {
+		return err
+	}
+
+	return nil
+}
+
+// deleteTargetRole deletes the IAM role of a target and its instance profile,
+// which share the same name, if they exist.
+func deleteTargetRole(sess *session.Session, roleName string) error {
+	client := iam.New(sess)
+
+	_, err := client.RemoveRoleFromInstanceProfile(&iam.RemoveRoleFromInstanceProfileInput{
+		InstanceProfileName: aws.String(roleName),
+		RoleName:            aws.String(roleName),
+	})
+	if err != nil && !isAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+
+	_, err = client.DeleteInstanceProfile(&iam.DeleteInstanceProfileInput{
+		InstanceProfileName: aws.String(roleName),
+	})
+	if err != nil && !isAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+
+	_, err = client.DeleteRolePolicy(&iam.DeleteRolePolicyInput{
+		RoleName:   aws.String(roleName),
+		PolicyName: aws.String(targetRolePolicyName),
+	})
+	if err != nil && !isAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+
+	_, err = client.DeleteRole(&iam.DeleteRoleInput{
+		RoleName: aws.String(roleName),
+	})
+	if err != nil && !isAwsErrorCode(err, iam.ErrCodeNoSuchEntityException) {
+		return err
+	}
+
+	return nil
+}
+
+// getSecretsParameterArn returns the ARN of the secrets parameter of a target.
+func getSecretsParameterArn(region, targetId string) string {
+	partition := "aws"
+	if p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region); ok {
+		partition = p.ID()
+	}
+
+	return fmt.Sprintf("arn:%s:ssm:%s:*:parameter%s", partition, region, getSecretsParameterName(targetId))
+}
+
+// isAccessDeniedError returns true if the credentials are not allowed to make
+// the SSM or IAM call.
+func isAccessDeniedError(err error) bool {
+	return isAwsErrorCode(err, "AccessDenied") || isAwsErrorCode(err, "AccessDeniedException")
+}
+
+// isInstanceProfilePropagationError returns true if the launch failed because
+// a newly created instance profile has not propagated yet.
+func isInstanceProfilePropagationError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == "InvalidParameterValue" && strings.Contains(strings.ToLower(awsErr.Message()), "iaminstanceprofile")
+}
+
+func isAwsErrorCode(err error, code string) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && awsErr.Code() == code
+}
+
+// runInstancesWithInstanceProfile launches the instance, retrying while the
+// instance profile of the target propagates through IAM.
+func runInstancesWithInstanceProfile(client *ec2.EC2, input *ec2.RunInstancesInput, opts *types.TargetOptions, subnets []*ec2.Subnet, launchToken string, logWriter io.Writer) (*ec2.Reservation, error) {
+	result, err := runInstances(client, input, opts, subnets, launchToken)
+	for i := 0; i < instanceProfileRetries && input.IamInstanceProfile != nil && isInstanceProfilePropagationError(err); i++ {
+		if i == 0 {
+			logWriter.Write([]byte("Waiting for the target instance profile to be available\n"))
+		}
+		time.Sleep(instanceProfileRetryInterval)
+		result, err = runInstances(client, input, opts, subnets, launchToken)
+	}
+
+	return result, err
+}
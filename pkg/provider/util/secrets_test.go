@@ -0,0 +1,33 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetSecretsParameterArn(t *testing.T) {
+	tests := map[string]string{
+		"us-east-1":     "arn:aws:ssm:us-east-1:*:parameter/daytona/targets/target1/env",
+		"cn-north-1":    "arn:aws-cn:ssm:cn-north-1:*:parameter/daytona/targets/target1/env",
+		"us-gov-west-1": "arn:aws-us-gov:ssm:us-gov-west-1:*:parameter/daytona/targets/target1/env",
+	}
+
+	for region, want := range tests {
+		got := getSecretsParameterArn(region, "target1")
+		if got != want {
+			t.Errorf("getSecretsParameterArn(%s) = %s, want %s", region, got, want)
+		}
+	}
+}
+
+func TestGetTargetRoleName(t *testing.T) {
+	got := getTargetRoleName("target1")
+	if got != "daytona-target-target1" {
+		t.Errorf("getTargetRoleName() = %s, want daytona-target-target1", got)
+	}
+
+	got = getTargetRoleName(strings.Repeat("a", 100))
+	if len(got) != maxRoleNameLen {
+		t.Errorf("getTargetRoleName() length = %d, want %d", len(got), maxRoleNameLen)
+	}
+}
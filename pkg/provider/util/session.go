@@ -0,0 +1,104 @@
+package util
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+const (
+	defaultRoleSessionName = "daytona"
+	maxRoleSessionNameLen  = 64
+
+	// roleSessionDuration is how long assumed role credentials are valid. One
+	// hour is the limit of chained roles and the lowest maximum session
+	// duration a role can have, so it is always allowed
+	roleSessionDuration = time.Hour
+)
+
+var invalidRoleSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// getSession creates a new AWS session using the provided target options.
+// Static credentials are used when both keys are set, otherwise the session
+// falls back to the named profile or the SDK's default credential chain.
+// If a role ARN is set, the resolved credentials are used to assume that role
+// and the session name includes the target id so that API calls can be traced
+// back to the target in CloudTrail.
+func getSession(opts *types.TargetOptions, targetId string) (*session.Session, error) {
+	config := aws.Config{
+		Region: aws.String(opts.Region),
+	}
+
+	if opts.AccessKeyId != "" && opts.SecretAccessKey != "" {
+		config.Credentials = credentials.NewStaticCredentials(
+			opts.AccessKeyId,
+			opts.SecretAccessKey,
+			"",
+		)
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            config,
+		Profile:           opts.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.RoleArn == "" {
+		return sess, nil
+	}
+
+	// API calls assume the role again once the credentials expire, but requests
+	// presigned with them stop working, see getUserDataUrlExpiry
+	roleCredentials := stscreds.NewCredentials(sess, opts.RoleArn, func(p *stscreds.AssumeRoleProvider) {
+		p.RoleSessionName = getRoleSessionName(opts.RoleSessionName, targetId)
+		p.Duration = roleSessionDuration
+		if opts.ExternalId != "" {
+			p.ExternalID = aws.String(opts.ExternalId)
+		}
+	})
+
+	_, err = roleCredentials.Get()
+	if err != nil {
+		return nil, fmt.Errorf("failed to assume role %s: %w", opts.RoleArn, err)
+	}
+
+	return sess.Copy(&aws.Config{Credentials: roleCredentials}), nil
+}
+
+// getRoleSessionName builds a valid STS role session name from the configured
+// prefix and the target id. The prefix is truncated so that the target id is
+// always preserved.
+func getRoleSessionName(prefix, targetId string) string {
+	if prefix == "" {
+		prefix = defaultRoleSessionName
+	}
+	prefix = invalidRoleSessionNameChars.ReplaceAllString(prefix, "-")
+	targetId = invalidRoleSessionNameChars.ReplaceAllString(targetId, "-")
+
+	if targetId == "" {
+		if len(prefix) > maxRoleSessionNameLen {
+			return prefix[:maxRoleSessionNameLen]
+		}
+		return prefix
+	}
+
+	if len(targetId) >= maxRoleSessionNameLen {
+		return targetId[:maxRoleSessionNameLen]
+	}
+
+	maxPrefixLen := maxRoleSessionNameLen - len(targetId) - 1
+	if len(prefix) > maxPrefixLen {
+		prefix = prefix[:maxPrefixLen]
+	}
+
+	return fmt.Sprintf("%s-%s", prefix, targetId)
+}
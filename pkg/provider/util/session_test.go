@@ -0,0 +1,56 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetRoleSessionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		prefix   string
+		targetId string
+		want     string
+	}{
+		{
+			name:     "Default prefix",
+			targetId: "abc123",
+			want:     "daytona-abc123",
+		},
+		{
+			name:     "Custom prefix",
+			prefix:   "ci",
+			targetId: "abc123",
+			want:     "ci-abc123",
+		},
+		{
+			name:   "No target id",
+			prefix: "daytona",
+			want:   "daytona",
+		},
+		{
+			name:     "Invalid characters are replaced",
+			prefix:   "my team",
+			targetId: "abc/123",
+			want:     "my-team-abc-123",
+		},
+		{
+			name:     "Long prefix is truncated to keep the target id",
+			prefix:   strings.Repeat("a", 70),
+			targetId: "abc123",
+			want:     strings.Repeat("a", 57) + "-abc123",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getRoleSessionName(tt.prefix, tt.targetId)
+			if got != tt.want {
+				t.Errorf("getRoleSessionName() = %s, want %s", got, tt.want)
+			}
+			if len(got) > maxRoleSessionNameLen {
+				t.Errorf("getRoleSessionName() length = %d, want <= %d", len(got), maxRoleSessionNameLen)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package util
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+const (
+	MarketTypeOnDemand = "on-demand"
+	MarketTypeSpot     = "spot"
+)
+
+// spotFallbackErrorCodes are the RunInstances error codes for which a spot
+// launch falls back to an on-demand launch.
+var spotFallbackErrorCodes = map[string]bool{
+	"InsufficientInstanceCapacity": true,
+	"SpotMaxPriceTooLow":           true,
+	"MaxSpotInstanceCountExceeded": true,
+	"UnfulfillableCapacity":        true,
+}
+
+// spotInterruptionStatusCodes are the spot request status codes of an instance
+// that is about to be, or has been, interrupted by AWS.
+var spotInterruptionStatusCodes = map[string]bool{
+	"marked-for-stop":                true,
+	"marked-for-termination":         true,
+	"marked-for-stop-by-experiment":  true,
+	"instance-stopped-by-price":      true,
+	"instance-stopped-no-capacity":   true,
+	"instance-stopped-by-experiment": true,
+}
+
+// spotStoppedStatusCodes are the spot request status codes of an instance that
+// was stopped by AWS. Only the spot service can start such an instance again.
+var spotStoppedStatusCodes = map[string]bool{
+	"instance-stopped-by-price":      true,
+	"instance-stopped-no-capacity":   true,
+	"instance-stopped-by-experiment": true,
+}
+
+// getInstanceMarketOptions returns the market options for a spot launch, or
+// nil for an on-demand launch.
+// Spot requests are persistent and stop the instance on interruption, so the
+// instance, along with its volumes, is kept until capacity is available again.
+func getInstanceMarketOptions(opts *types.TargetOptions) *ec2.InstanceMarketOptionsRequest {
+	if opts.PurchasingOption != types.PurchasingOptionSpot && opts.PurchasingOption != types.PurchasingOptionSpotWithFallback {
+		return nil
+	}
+
+	spotOptions := &ec2.SpotMarketOptions{
+		SpotInstanceType:             aws.String(ec2.SpotInstanceTypePersistent),
+		InstanceInterruptionBehavior: aws.String(ec2.InstanceInterruptionBehaviorStop),
+	}
+	if opts.SpotMaxPrice != "" {
+		spotOptions.MaxPrice = aws.String(opts.SpotMaxPrice)
+	}
+
+	return &ec2.InstanceMarketOptionsRequest{
+		MarketType:  aws.String(ec2.MarketTypeSpot),
+		SpotOptions: spotOptions,
+	}
+}
+
+// isSpotFallbackError returns true if a failed spot launch should be retried
+// as an on-demand launch.
+func isSpotFallbackError(err error) bool {
+	awsErr, ok := err.(awserr.Error)
+	return ok && spotFallbackErrorCodes[awsErr.Code()]
+}
+
+// GetMarketType returns the market type of the instance, either on-demand or spot.
+func GetMarketType(instance *ec2.Instance) string {
+	if instance.InstanceLifecycle != nil && *instance.InstanceLifecycle == ec2.InstanceLifecycleTypeSpot {
+		return MarketTypeSpot
+	}
+	return MarketTypeOnDemand
+}
+
+// getSpotRequestStatus returns the status code of the spot request of the
+// instance, or an empty string if the instance is not a spot instance.
+func getSpotRequestStatus(client *ec2.EC2, instance *ec2.Instance) (string, error) {
+	if instance.SpotInstanceRequestId == nil {
+		return "", nil
+	}
+
+	result, err := client.DescribeSpotInstanceRequests(&ec2.DescribeSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: []*string{instance.SpotInstanceRequestId},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(result.SpotInstanceRequests) == 0 || result.SpotInstanceRequests[0].Status == nil {
+		return "", nil
+	}
+
+	return aws.StringValue(result.SpotInstanceRequests[0].Status.Code), nil
+}
+
+// cancelSpotRequest cancels the persistent spot request of the instance so
+// that AWS does not launch a replacement once the instance is terminated.
+func cancelSpotRequest(client *ec2.EC2, instance *ec2.Instance) error {
+	if instance.SpotInstanceRequestId == nil {
+		return nil
+	}
+
+	_, err := client.CancelSpotInstanceRequests(&ec2.CancelSpotInstanceRequestsInput{
+		SpotInstanceRequestIds: []*string{instance.SpotInstanceRequestId},
+	})
+	return err
+}
+
+// GetSpotInterruption returns the spot request status code if the instance has
+// a pending or past interruption, otherwise an empty string.
+func GetSpotInterruption(target *models.Target, opts *types.TargetOptions, instance *ec2.Instance) (string, error) {
+	client, err := getEC2Client(opts, target.Id)
+	if err != nil {
+		return "", err
+	}
+
+	status, err := getSpotRequestStatus(client, instance)
+	if err != nil {
+		return "", err
+	}
+
+	if !spotInterruptionStatusCodes[status] {
+		return "", nil
+	}
+
+	return status, nil
+}
@@ -0,0 +1,208 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+const (
+	// maxUserDataSize is the EC2 limit of the user data, before base64 encoding
+	maxUserDataSize = 16384
+	// userDataUrlExpiry is how long the instance can fetch offloaded user data,
+	// unless the credentials that presign the URL expire earlier
+	userDataUrlExpiry = 2 * time.Hour
+	// minUserDataUrlExpiry is how long the instance must at least be able to
+	// fetch offloaded user data
+	minUserDataUrlExpiry = 15 * time.Minute
+)
+
+// prepareUserData returns the user data to launch the instance with. User data
+// over the EC2 limit is gzipped, which cloud-init detects. If it is still over
+// the limit, it is uploaded to the user data bucket and replaced by a stub that
+// includes it from a presigned URL.
+func prepareUserData(sess *session.Session, opts *types.TargetOptions, targetId, userData string, logWriter io.Writer) (string, error) {
+	payload, err := compressUserData(userData)
+	if err != nil {
+		return "", err
+	}
+
+	if len(payload) <= maxUserDataSize {
+		return payload, nil
+	}
+
+	if opts.UserDataBucket == "" {
+		return "", fmt.Errorf("user data is %d bytes after compression, over the EC2 limit of %d bytes. Set the User Data Bucket option to upload it to S3", len(payload), maxUserDataSize)
+	}
+
+	logWriter.Write([]byte(fmt.Sprintf("User data is over the EC2 limit of %d bytes, uploading it to s3://%s\n", maxUserDataSize, opts.UserDataBucket)))
+
+	userDataUrl, err := uploadUserData(sess, opts, targetId, userData)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("#include\n%s\n", userDataUrl), nil
+}
+
+// compressUserData returns the user data as is if it fits the EC2 limit, or gzipped otherwise.
+func compressUserData(userData string) (string, error) {
+	if len(userData) <= maxUserDataSize {
+		return userData, nil
+	}
+
+	var compressed bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = writer.Write([]byte(userData))
+	if err != nil {
+		return "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return compressed.String(), nil
+}
+
+// uploadUserData uploads the user data, encrypted at rest, to the user data
+// bucket and returns a presigned URL to fetch it.
+func uploadUserData(sess *session.Session, opts *types.TargetOptions, targetId, userData string) (string, error) {
+	client, err := getUserDataS3Client(sess, opts)
+	if err != nil {
+		return "", err
+	}
+
+	key := getUserDataKey(opts, targetId)
+	_, err = client.PutObject(&s3.PutObjectInput{
+		Bucket:               aws.String(opts.UserDataBucket),
+		Key:                  aws.String(key),
+		Body:                 strings.NewReader(userData),
+		ContentType:          aws.String("text/plain"),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAes256),
+		Tagging:              aws.String(url.Values{"WorkspaceID": []string{targetId}}.Encode()),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to upload user data to s3://%s/%s: %w", opts.UserDataBucket, key, err)
+	}
+
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(opts.UserDataBucket),
+		Key:    aws.String(key),
+	})
+
+	expiry, err := getUserDataUrlExpiry(client.Config.Credentials, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	return req.Presign(expiry)
+}
+
+// getUserDataUrlExpiry returns how long the presigned URL of the user data is
+// valid. A URL presigned with temporary credentials, e.g. of an assumed role,
+// stops working once they expire, so it expires with them at the latest.
+// Credentials about to expire are renewed first.
+func getUserDataUrlExpiry(creds *credentials.Credentials, now time.Time) (time.Duration, error) {
+	expiry, err := getCredentialsLifetime(creds, now)
+	if err != nil || expiry >= minUserDataUrlExpiry {
+		return expiry, err
+	}
+
+	creds.Expire()
+	expiry, err = getCredentialsLifetime(creds, now)
+	if err != nil {
+		return 0, err
+	}
+	if expiry < minUserDataUrlExpiry {
+		return 0, fmt.Errorf("credentials expire in %s, too soon for the instance to fetch its user data", expiry.Round(time.Second))
+	}
+
+	return expiry, nil
+}
+
+// getCredentialsLifetime returns how long the credentials are valid, up to
+// userDataUrlExpiry.
+func getCredentialsLifetime(creds *credentials.Credentials, now time.Time) (time.Duration, error) {
+	_, err := creds.Get()
+	if err != nil {
+		return 0, err
+	}
+
+	expiresAt, err := creds.ExpiresAt()
+	if err != nil {
+		// The credentials do not expire
+		return userDataUrlExpiry, nil
+	}
+
+	if expiresAt.Sub(now) < userDataUrlExpiry {
+		return expiresAt.Sub(now), nil
+	}
+	return userDataUrlExpiry, nil
+}
+
+// DeleteUserData deletes the user data uploaded for the target, if any. The
+// instance only fetches it on its first boot.
+func DeleteUserData(target *models.Target, opts *types.TargetOptions) error {
+	if opts.UserDataBucket == "" {
+		return nil
+	}
+
+	sess, err := getSession(opts, target.Id)
+	if err != nil {
+		return err
+	}
+
+	return deleteUserData(sess, opts, target.Id)
+}
+
+func deleteUserData(sess *session.Session, opts *types.TargetOptions, targetId string) error {
+	if opts.UserDataBucket == "" {
+		return nil
+	}
+
+	client, err := getUserDataS3Client(sess, opts)
+	if err != nil {
+		return err
+	}
+
+	// Deleting an object that does not exist succeeds
+	_, err = client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(opts.UserDataBucket),
+		Key:    aws.String(getUserDataKey(opts, targetId)),
+	})
+	return err
+}
+
+// getUserDataS3Client returns an S3 client for the region of the user data bucket.
+func getUserDataS3Client(sess *session.Session, opts *types.TargetOptions) (*s3.S3, error) {
+	region, err := s3manager.GetBucketRegion(context.Background(), sess, opts.UserDataBucket, opts.Region)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the region of bucket %s: %w", opts.UserDataBucket, err)
+	}
+
+	return s3.New(sess, aws.NewConfig().WithRegion(region)), nil
+}
+
+func getUserDataKey(opts *types.TargetOptions, targetId string) string {
+	return path.Join(opts.UserDataPrefix, targetId, "user-data")
+}
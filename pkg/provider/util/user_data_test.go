@@ -0,0 +1,118 @@
+package util
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/daytonaio/daytona-provider-aws/pkg/types"
+)
+
+func TestCompressUserData(t *testing.T) {
+	small := "#!/bin/bash\necho small\n"
+	got, err := compressUserData(small)
+	if err != nil {
+		t.Fatalf("Error compressing user data: %v", err)
+	}
+	if got != small {
+		t.Errorf("Expected user data under the limit to be unchanged")
+	}
+
+	large := "#!/bin/bash\n" + strings.Repeat("echo large\n", 2*maxUserDataSize)
+	got, err = compressUserData(large)
+	if err != nil {
+		t.Fatalf("Error compressing user data: %v", err)
+	}
+	if len(got) > maxUserDataSize {
+		t.Errorf("Expected compressed user data to be under the limit but got %d bytes", len(got))
+	}
+
+	reader, err := gzip.NewReader(strings.NewReader(got))
+	if err != nil {
+		t.Fatalf("Error reading compressed user data: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Error reading compressed user data: %v", err)
+	}
+	if !bytes.Equal(decompressed, []byte(large)) {
+		t.Errorf("Decompressed user data does not match")
+	}
+
+	random := make([]byte, maxUserDataSize)
+	_, err = rand.Read(random)
+	if err != nil {
+		t.Fatalf("Error generating random data: %v", err)
+	}
+	got, err = compressUserData(base64.StdEncoding.EncodeToString(random))
+	if err != nil {
+		t.Fatalf("Error compressing user data: %v", err)
+	}
+	if len(got) <= maxUserDataSize {
+		t.Errorf("Expected incompressible user data to stay over the limit but got %d bytes", len(got))
+	}
+}
+
+func TestGetUserDataKey(t *testing.T) {
+	tests := map[string]string{
+		"":                   "target1/user-data",
+		"daytona/user-data/": "daytona/user-data/target1/user-data",
+		"daytona/user-data":  "daytona/user-data/target1/user-data",
+	}
+
+	for prefix, want := range tests {
+		got := getUserDataKey(&types.TargetOptions{UserDataPrefix: prefix}, "target1")
+		if got != want {
+			t.Errorf("getUserDataKey(%s) = %s, want %s", prefix, got, want)
+		}
+	}
+}
+
+// expiringProvider returns credentials that expire after the next of the given
+// lifetimes, one per retrieval.
+type expiringProvider struct {
+	credentials.Expiry
+	now       time.Time
+	lifetimes []time.Duration
+}
+
+func (p *expiringProvider) Retrieve() (credentials.Value, error) {
+	p.SetExpiration(p.now.Add(p.lifetimes[0]), 0)
+	p.lifetimes = p.lifetimes[1:]
+	return credentials.Value{AccessKeyID: "id", SecretAccessKey: "secret"}, nil
+}
+
+func TestGetUserDataUrlExpiry(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		creds     *credentials.Credentials
+		want      time.Duration
+		wantError bool
+	}{
+		{name: "Static credentials", creds: credentials.NewStaticCredentials("id", "secret", ""), want: userDataUrlExpiry},
+		{name: "Long-lived credentials", creds: credentials.NewCredentials(&expiringProvider{now: now, lifetimes: []time.Duration{12 * time.Hour}}), want: userDataUrlExpiry},
+		{name: "Assumed role credentials", creds: credentials.NewCredentials(&expiringProvider{now: now, lifetimes: []time.Duration{time.Hour}}), want: time.Hour},
+		{name: "Renewed credentials", creds: credentials.NewCredentials(&expiringProvider{now: now, lifetimes: []time.Duration{time.Minute, time.Hour}}), want: time.Hour},
+		{name: "Short-lived credentials", creds: credentials.NewCredentials(&expiringProvider{now: now, lifetimes: []time.Duration{time.Minute, time.Minute}}), wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getUserDataUrlExpiry(tt.creds, now)
+			if (err != nil) != tt.wantError {
+				t.Fatalf("getUserDataUrlExpiry() error = %v, wantError %v", err, tt.wantError)
+			}
+			if !tt.wantError && got != tt.want {
+				t.Errorf("getUserDataUrlExpiry() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,35 @@
 package types
 
+const (
+	// TargetStateMissing is the state of a target whose instance no longer exists
+	TargetStateMissing = "missing"
+	// TargetStateDuplicate is the state of a target with more than one instance
+	TargetStateDuplicate = "duplicate"
+)
+
 type TargetMetadata struct {
 	InstanceId string
+	// State is the instance state, or TargetStateMissing or TargetStateDuplicate
+	State      string
 	Tags       map[string]string
 	IsRunning  bool
 	Created    string
+	ImageId    string
+	ImageName  string
+	MarketType string
+	// SpotInterruption is the spot request status code of a pending or past interruption
+	SpotInterruption string `json:",omitempty"`
+	VolumeEncrypted  bool
+	// VolumeKmsKeyId is the ARN of the KMS key the root volume is encrypted with
+	VolumeKmsKeyId string `json:",omitempty"`
+	// LastActivity and ScheduledStop are the RFC 3339 times the target was last
+	// active and will be stopped at, if it is stopped automatically when idle
+	LastActivity  string `json:",omitempty"`
+	ScheduledStop string `json:",omitempty"`
+	// NextScheduledStart and NextScheduledStop are the RFC 3339 times of the next
+	// start and stop of the Schedule of the target
+	NextScheduledStart string `json:",omitempty"`
+	NextScheduledStop  string `json:",omitempty"`
+	// ExpiresAt is the RFC 3339 time the TTL of the target passes
+	ExpiresAt string `json:",omitempty"`
 }
@@ -0,0 +1,182 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/daytonaio/daytona/pkg/models"
+)
+
+// PresetTargetConfig is a named set of target options. Options not set by the
+// preset take the default value from the target config manifest.
+type PresetTargetConfig struct {
+	Name    string                 `json:"name" yaml:"name"`
+	Options map[string]interface{} `json:"options" yaml:"options"`
+}
+
+// GetBuiltinPresetTargetConfigs returns the presets shipped with the provider.
+func GetBuiltinPresetTargetConfigs() []PresetTargetConfig {
+	return []PresetTargetConfig{
+		{
+			Name: "aws-small-x86",
+			Options: map[string]interface{}{
+				"Instance Type": "t3.medium",
+				"Image Id":      DefaultImageId,
+				"Device Name":   "/dev/sda1",
+				"Volume Size":   30,
+				"Volume Type":   "gp3",
+			},
+		},
+		{
+			Name: "aws-large-x86",
+			Options: map[string]interface{}{
+				"Instance Type": "m7i.2xlarge",
+				"Image Id":      DefaultImageId,
+				"Device Name":   "/dev/sda1",
+				"Volume Size":   100,
+				"Volume Type":   "gp3",
+			},
+		},
+		{
+			Name: "aws-graviton-arm64",
+			Options: map[string]interface{}{
+				"Instance Type": "m7g.xlarge",
+				"Image Id":      DefaultArm64ImageId,
+				"Device Name":   "/dev/sda1",
+				"Volume Size":   50,
+				"Volume Type":   "gp3",
+			},
+		},
+		{
+			Name: "aws-memory-heavy",
+			Options: map[string]interface{}{
+				"Instance Type": "r7i.2xlarge",
+				"Image Id":      DefaultImageId,
+				"Device Name":   "/dev/sda1",
+				"Volume Size":   100,
+				"Volume Type":   "gp3",
+			},
+		},
+		{
+			Name: "aws-spot-cheap",
+			Options: map[string]interface{}{
+				"Instance Type":     "t3.large",
+				"Image Id":          DefaultImageId,
+				"Device Name":       "/dev/sda1",
+				"Volume Size":       30,
+				"Volume Type":       "gp3",
+				"Purchasing Option": PurchasingOptionSpotWithFallback,
+			},
+		},
+	}
+}
+
+// GetOptionsJson validates the preset options against the target config
+// manifest and returns them, merged with the manifest defaults, as JSON.
+func (p *PresetTargetConfig) GetOptionsJson() (string, error) {
+	if p.Name == "" {
+		return "", fmt.Errorf("preset name not set")
+	}
+
+	options, err := getDefaultOptionValues()
+	if err != nil {
+		return "", err
+	}
+
+	manifest := *GetTargetConfigManifest()
+	for name, value := range p.Options {
+		property, ok := manifest[name]
+		if !ok {
+			return "", fmt.Errorf("preset %s: unknown option %s", p.Name, name)
+		}
+
+		err := validateOptionValue(property, value)
+		if err != nil {
+			return "", fmt.Errorf("preset %s: invalid value of %s: %w", p.Name, name, err)
+		}
+
+		options[name] = value
+	}
+
+	optionsJson, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = ParseTargetOptions(string(optionsJson))
+	if err != nil {
+		return "", fmt.Errorf("preset %s: %w", p.Name, err)
+	}
+
+	return string(optionsJson), nil
+}
+
+// validateOptionValue validates that the value matches the type of the
+// target config property.
+func validateOptionValue(property models.TargetConfigProperty, value interface{}) error {
+	switch property.Type {
+	case models.TargetConfigPropertyTypeInt:
+		switch v := value.(type) {
+		case int:
+			return nil
+		case float64:
+			if v == float64(int(v)) {
+				return nil
+			}
+		}
+		return fmt.Errorf("expected an integer, got %v", value)
+	case models.TargetConfigPropertyTypeFloat:
+		switch value.(type) {
+		case int, float64:
+			return nil
+		}
+		return fmt.Errorf("expected a number, got %v", value)
+	case models.TargetConfigPropertyTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("expected a boolean, got %v", value)
+		}
+	case models.TargetConfigPropertyTypeOption:
+		v, ok := value.(string)
+		if !ok || !slices.Contains(property.Options, v) {
+			return fmt.Errorf("expected one of %v, got %v", property.Options, value)
+		}
+	default:
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("expected a string, got %v", value)
+		}
+	}
+
+	return nil
+}
+
+// getDefaultOptionValues returns the default values of the target config
+// manifest, converted to their property types.
+func getDefaultOptionValues() (map[string]interface{}, error) {
+	defaultOptions := map[string]interface{}{}
+	for name, property := range *GetTargetConfigManifest() {
+		if property.DefaultValue == "" {
+			continue
+		}
+
+		switch property.Type {
+		case models.TargetConfigPropertyTypeInt:
+			value, err := strconv.Atoi(property.DefaultValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid default value of %s: %w", name, err)
+			}
+			defaultOptions[name] = value
+		case models.TargetConfigPropertyTypeBoolean:
+			value, err := strconv.ParseBool(property.DefaultValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid default value of %s: %w", name, err)
+			}
+			defaultOptions[name] = value
+		default:
+			defaultOptions[name] = property.DefaultValue
+		}
+	}
+
+	return defaultOptions, nil
+}
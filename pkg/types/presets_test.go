@@ -0,0 +1,101 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBuiltinPresetTargetConfigs(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "")
+
+	for _, preset := range GetBuiltinPresetTargetConfigs() {
+		optionsJson, err := preset.GetOptionsJson()
+		if err != nil {
+			t.Errorf("Expected preset %s to be valid but got %v", preset.Name, err)
+			continue
+		}
+
+		targetOptions, err := ParseTargetOptions(optionsJson)
+		if err != nil {
+			t.Errorf("Expected preset %s options to parse but got %v", preset.Name, err)
+			continue
+		}
+
+		if targetOptions.InstanceType != preset.Options["Instance Type"] {
+			t.Errorf("Expected preset %s instance type %v but got %s", preset.Name, preset.Options["Instance Type"], targetOptions.InstanceType)
+		}
+	}
+}
+
+func TestPresetTargetConfigGetOptionsJson(t *testing.T) {
+	tests := []struct {
+		name    string
+		preset  PresetTargetConfig
+		wantErr bool
+	}{
+		{
+			name: "Valid preset from JSON numbers",
+			preset: PresetTargetConfig{
+				Name: "custom",
+				Options: map[string]interface{}{
+					"Instance Type": "c7i.large",
+					"Volume Size":   float64(40),
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Missing name",
+			preset: PresetTargetConfig{
+				Options: map[string]interface{}{"Instance Type": "c7i.large"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Unknown option",
+			preset: PresetTargetConfig{
+				Name:    "custom",
+				Options: map[string]interface{}{"Instance Size": "large"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Invalid option type",
+			preset: PresetTargetConfig{
+				Name:    "custom",
+				Options: map[string]interface{}{"Volume Size": "40GB"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Value not in option list",
+			preset: PresetTargetConfig{
+				Name:    "custom",
+				Options: map[string]interface{}{"Purchasing Option": "reserved"},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			optionsJson, err := tt.preset.GetOptionsJson()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetOptionsJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			var options map[string]interface{}
+			err = json.Unmarshal([]byte(optionsJson), &options)
+			if err != nil {
+				t.Fatalf("Expected options JSON but got %v", err)
+			}
+
+			if options["Region"] != "us-east-1" {
+				t.Errorf("Expected default region to be merged but got %v", options["Region"])
+			}
+		})
+	}
+}
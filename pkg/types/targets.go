@@ -4,10 +4,56 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/daytonaio/daytona-provider-aws/internal/schedule"
 	"github.com/daytonaio/daytona/pkg/models"
 )
 
+const (
+	// ImageIdSsmPrefix is the prefix of an Image Id that references an SSM parameter holding the AMI id
+	ImageIdSsmPrefix = "resolve:ssm:"
+	DefaultImageId   = ImageIdSsmPrefix + "/aws/service/canonical/ubuntu/server/24.04/stable/current/amd64/hvm/ebs-gp3/ami-id"
+	// DefaultArm64ImageId is the default image for instance types with AWS Graviton processors
+	DefaultArm64ImageId = ImageIdSsmPrefix + "/aws/service/canonical/ubuntu/server/24.04/stable/current/arm64/hvm/ebs-gp3/ami-id"
+)
+
+const (
+	PurchasingOptionOnDemand         = "on-demand"
+	PurchasingOptionSpot             = "spot"
+	PurchasingOptionSpotWithFallback = "spot-with-on-demand-fallback"
+)
+
+const (
+	// DeletionPolicyDelete deletes the data volume with the target
+	DeletionPolicyDelete = "delete"
+	// DeletionPolicyRetain keeps the data volume when the target is destroyed
+	DeletionPolicyRetain = "retain"
+)
+
+const (
+	// SecretsStoreSsmParameter stores the target env vars in an encrypted SSM parameter
+	SecretsStoreSsmParameter = "ssm-parameter"
+	// SecretsStoreUserData embeds the target env vars in the instance user data
+	SecretsStoreUserData = "user-data"
+)
+
+const (
+	// StopBehaviorStop shuts the instance down when the target is stopped
+	StopBehaviorStop = "stop"
+	// StopBehaviorHibernate saves the memory of the instance to its root volume when the target is stopped
+	StopBehaviorHibernate = "hibernate"
+)
+
+const (
+	// TTLActionStop stops the instance of an expired target, keeping its volumes
+	TTLActionStop = "stop"
+	// TTLActionTerminate terminates the instance of an expired target and deletes its resources
+	TTLActionTerminate = "terminate"
+)
+
 type TargetOptions struct {
 	Region          string `json:"Region"`
 	ImageId         string `json:"Image Id"`
@@ -17,8 +63,50 @@ type TargetOptions struct {
 	VolumeType      string `json:"Volume Type"`
 	AccessKeyId     string `json:"Access Key Id"`
 	SecretAccessKey string `json:"Secret Access Key"`
+	Profile         string `json:"Profile"`
+	RoleArn         string `json:"Role ARN"`
+	ExternalId      string `json:"External Id"`
+	RoleSessionName string `json:"Role Session Name"`
+	// SubnetIds is a comma separated list of subnet ids, see SubnetIdList
+	SubnetIds string `json:"Subnet Ids"`
+	// SecurityGroupIds is a comma separated list of security group ids, see SecurityGroupIdList
+	SecurityGroupIds  string `json:"Security Group Ids"`
+	AssociatePublicIp *bool  `json:"Associate Public IP,omitempty"`
+	PurchasingOption  string `json:"Purchasing Option"`
+	SpotMaxPrice      string `json:"Spot Max Price"`
+	KeepOnFailure     bool   `json:"Keep On Failure"`
+	SecretsStore      string `json:"Secrets Store"`
+	// AdditionalUserData is the path of a file, or a directory of files, appended to the instance user data
+	AdditionalUserData string `json:"Additional User Data"`
+	UserDataBucket     string `json:"User Data Bucket"`
+	UserDataPrefix     string `json:"User Data Prefix"`
+	EncryptVolume      bool   `json:"Encrypt Volume"`
+	KmsKeyId           string `json:"KMS Key Id"`
+	// Iops and Throughput are the provisioned IOPS and throughput of the volume, zero for the baseline
+	Iops       int `json:"IOPS"`
+	Throughput int `json:"Throughput"`
+	// DataVolumeSize is the size of the data volume in GiB, zero for no data volume
+	DataVolumeSize int    `json:"Data Volume Size"`
+	DataVolumeType string `json:"Data Volume Type"`
+	// DataVolumeIops and DataVolumeThroughput are the provisioned IOPS and throughput of the data volume, zero for the baseline
+	DataVolumeIops           int    `json:"Data Volume IOPS"`
+	DataVolumeThroughput     int    `json:"Data Volume Throughput"`
+	DataVolumeMountPath      string `json:"Data Volume Mount Path"`
+	DataVolumeDeletionPolicy string `json:"Data Volume Deletion Policy"`
+	StopBehavior             string `json:"Stop Behavior"`
+	// AutoStopAfter is the duration without activity after which the target is stopped, see AutoStopDuration
+	AutoStopAfter string `json:"Auto Stop After"`
+	// Schedule is the start and stop schedule of the target, see GetSchedule
+	Schedule         string `json:"Schedule"`
+	ScheduleTimezone string `json:"Schedule Timezone"`
+	// TTL is the lifetime of the instance of the target, see TTLDuration
+	TTL       string `json:"TTL"`
+	TTLAction string `json:"TTL Action"`
 }
 
+// MinAutoStopAfter is the shortest Auto Stop After duration, activity is sampled every minute
+const MinAutoStopAfter = 5 * time.Minute
+
 func GetTargetConfigManifest() *models.TargetConfigManifest {
 	return &models.TargetConfigManifest{
 		"Region": models.TargetConfigProperty{
@@ -36,9 +124,16 @@ func GetTargetConfigManifest() *models.TargetConfigManifest {
 		},
 		"Image Id": models.TargetConfigProperty{
 			Type:         models.TargetConfigPropertyTypeString,
-			DefaultValue: "ami-04a81a99f5ec58529",
-			Description: "The ID of the Amazon Machine Image (AMI) to launch an instance. Default is ami-04a81a99f5ec58529.\n" +
+			DefaultValue: DefaultImageId,
+			Description: "The Amazon Machine Image (AMI) to launch an instance. Default is the latest Ubuntu 24.04 AMI of the region.\n" +
+				"Either an AMI ID (ami-0123), an SSM parameter holding the AMI ID (resolve:ssm:<parameter path>)\n" +
+				"or an owner and a name pattern of which the most recent AMI is used (099720109477:ubuntu/images/*ubuntu-noble-24.04-amd64-server-*).\n" +
 				"How to find AMI that meets your needs:\nhttps://docs.aws.amazon.com/AWSEC2/latest/UserGuide/finding-an-ami.html",
+			Suggestions: []string{
+				DefaultImageId,
+				DefaultArm64ImageId,
+				ImageIdSsmPrefix + "/aws/service/canonical/ubuntu/server/22.04/stable/current/amd64/hvm/ebs-gp2/ami-id",
+			},
 		},
 		"Device Name": models.TargetConfigProperty{
 			Type:         models.TargetConfigPropertyTypeString,
@@ -62,15 +157,218 @@ func GetTargetConfigManifest() *models.TargetConfigManifest {
 			Type:        models.TargetConfigPropertyTypeString,
 			InputMasked: true,
 			Description: "Find this in the AWS Console under \"My Security Credentials\"\nhttps://aws.amazon.com/premiumsupport/knowledge-center/manage-access-keys/\n" +
-				"Leave blank if you've set the AWS_ACCESS_KEY_ID environment variable, or enter your Id here.",
+				"Leave blank if you've set the AWS_ACCESS_KEY_ID environment variable, or enter your Id here.\n" +
+				"If no access key is set, the profile or the default AWS credential chain is used.",
 		},
 		"Secret Access Key": models.TargetConfigProperty{
 			Type:        models.TargetConfigPropertyTypeString,
 			InputMasked: true,
 			Description: "Find this in the AWS Console under \"My Security Credentials\"\nhttps://aws.amazon.com/premiumsupport/knowledge-center/manage-access-keys/\n" +
-				"Leave blank if you've set the AWS_SECRET_ACCESS_KEY environment variable, or enter your key here.",
+				"Leave blank if you've set the AWS_SECRET_ACCESS_KEY environment variable, or enter your key here.\n" +
+				"If no secret access key is set, the profile or the default AWS credential chain is used.",
+		},
+		"Profile": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The named profile from the shared AWS config and credentials files (~/.aws/config, ~/.aws/credentials).\n" +
+				"Profiles using SSO, credential_process or role assumption are supported.\n" +
+				"Leave blank if you've set the AWS_PROFILE environment variable, or to use the default credential chain\n" +
+				"(environment, shared config, container and instance roles) when no access keys are set.",
+		},
+		"Role ARN": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The ARN of an IAM role to assume before managing instances, e.g. for provisioning targets in another account.\n" +
+				"The role is assumed with the configured credentials and refreshed automatically.\n" +
+				"Leave blank to use the configured credentials directly.",
+		},
+		"External Id": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The external ID required by the trust policy of the assumed role.\n" +
+				"Only used if Role ARN is set.",
+		},
+		"Role Session Name": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeString,
+			DefaultValue: "daytona",
+			Description: "The prefix of the assumed role session name. The target ID is appended to it so that\n" +
+				"API calls can be traced back to a target in CloudTrail. Only used if Role ARN is set.",
+		},
+		"Subnet Ids": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "A comma separated list of subnet IDs to launch the instance in, e.g. subnet-0123,subnet-4567.\n" +
+				"The subnets must belong to the same VPC and are tried in order if one has no capacity for the instance type.\n" +
+				"Leave blank to use the default subnet of the default VPC.",
+		},
+		"Security Group Ids": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "A comma separated list of security group IDs to attach to the instance, e.g. sg-0123,sg-4567.\n" +
+				"The security groups must belong to the VPC of the subnets.\n" +
+				"Leave blank to use the default security group of the VPC.",
+		},
+		"Associate Public IP": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeBoolean,
+			DefaultValue: "true",
+			Description: "Whether to associate a public IP address with the instance. Only used if Subnet Ids is set.\n" +
+				"Instances without a public IP address need a NAT gateway to reach the Daytona server.",
+		},
+		"Purchasing Option": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: PurchasingOptionOnDemand,
+			Options:      []string{PurchasingOptionOnDemand, PurchasingOptionSpot, PurchasingOptionSpotWithFallback},
+			Description: "How the instance is purchased. Spot instances are stopped, not terminated, when AWS interrupts them\n" +
+				"and are started again by AWS once capacity is available. With spot-with-on-demand-fallback,\n" +
+				"an on-demand instance is launched if no spot capacity is available.\n" +
+				"https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/using-spot-instances.html",
+		},
+		"Spot Max Price": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The maximum hourly price, in USD, to pay for a spot instance, e.g. 0.05.\n" +
+				"Leave blank to use the on-demand price as the maximum. Only used for spot instances.",
+		},
+		"Keep On Failure": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeBoolean,
+			DefaultValue: "false",
+			Description: "For debugging only. If the target creation fails, keep the instance running for inspection\n" +
+				"and tag it with DaytonaStatus=failed instead of terminating it. The instance keeps being billed.",
+		},
+		"Secrets Store": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: SecretsStoreSsmParameter,
+			Options:      []string{SecretsStoreSsmParameter, SecretsStoreUserData},
+			Description: "Where the target env vars, including the target API key, are stored for the instance.\n" +
+				"With ssm-parameter, they are stored in an encrypted SSM parameter that only the instance role of the\n" +
+				"target can read. With user-data, they are embedded in plaintext in the instance user data.",
+		},
+		"Additional User Data": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeFilePath,
+			Description: "Path to a script or cloud-config file, or to a directory of such files, added to the instance user data\n" +
+				"after the Daytona bootstrap, e.g. to install CA certificates or tooling. Scripts must start with #!\n" +
+				"and cloud-config files with #cloud-config. https://cloudinit.readthedocs.io/en/latest/explanation/format.html",
+		},
+		"User Data Bucket": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The S3 bucket the user data is uploaded to if it is over the EC2 limit of 16 KB even after compression.\n" +
+				"The instance fetches it from a presigned URL on its first boot, and it is deleted once the agent is started.",
+		},
+		"User Data Prefix": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeString,
+			DefaultValue: "daytona/user-data/",
+			Description:  "The key prefix of the user data uploaded to the User Data Bucket.",
+		},
+		"Encrypt Volume": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeBoolean,
+			DefaultValue: "false",
+			Description: "Whether to encrypt the EBS volumes of the instance. If disabled, the EBS encryption by default\n" +
+				"setting of the account and region applies.",
+		},
+		"KMS Key Id": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The id, ARN, alias or alias ARN of the KMS key used to encrypt the EBS volumes, e.g. alias/daytona.\n" +
+				"Leave blank to use the default EBS key of the region. Requires Encrypt Volume.",
+		},
+		"IOPS": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "0",
+			Description: "The provisioned IOPS of the volume. Leave at 0 for the baseline of gp3 volumes, 3000 IOPS.\n" +
+				"gp3: 3000 to 80000, at most 500 per GiB. io1: 100 to 64000, at most 50 per GiB. io2: 100 to 256000,\n" +
+				"at most 1000 per GiB. Required for io1 and io2 volumes, not supported by other volume types.",
+		},
+		"Throughput": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "0",
+			Description: "The provisioned throughput of gp3 volumes, in MiB/s. Leave at 0 for the baseline of 125 MiB/s.\n" +
+				"125 to 2000, at most 0.25 MiB/s per IOPS.",
+		},
+		"Data Volume Size": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "0",
+			Description: "The size of the data volume, in GB. Leave at 0 to keep all data on the instance volume.\n" +
+				"The data volume holds the Docker data root and the workspaces, and is kept when the instance is replaced.",
+		},
+		"Data Volume Type": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeString,
+			DefaultValue: "gp3",
+			Description:  "The type of the data volume. Only used if Data Volume Size is set.",
+		},
+		"Data Volume IOPS": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "0",
+			Description: "The provisioned IOPS of the data volume, with the same limits as IOPS. Required for io1 and io2\n" +
+				"data volumes. Only used if Data Volume Size is set.",
+		},
+		"Data Volume Throughput": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeInt,
+			DefaultValue: "0",
+			Description: "The provisioned throughput of gp3 data volumes, in MiB/s, with the same limits as Throughput.\n" +
+				"Only used if Data Volume Size is set.",
+		},
+		"Data Volume Mount Path": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeString,
+			DefaultValue: "/data",
+			Description:  "The path the data volume is mounted at on the instance. Only used if Data Volume Size is set.",
+		},
+		"Data Volume Deletion Policy": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: DeletionPolicyDelete,
+			Options:      []string{DeletionPolicyDelete, DeletionPolicyRetain},
+			Description: "Whether the data volume is deleted when the target is destroyed, or retained.\n" +
+				"Retained volumes keep being billed and must be deleted manually.",
+		},
+		"Stop Behavior": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: StopBehaviorStop,
+			Options:      []string{StopBehaviorStop, StopBehaviorHibernate},
+			Description: "What happens to the instance when the target is stopped. With hibernate, the memory of the instance is\n" +
+				"saved to its root volume, which is encrypted and enlarged by the memory size, and running processes resume\n" +
+				"on start. Falls back to stop if the instance type or image does not support hibernation.\n" +
+				"https://docs.aws.amazon.com/AWSEC2/latest/UserGuide/Hibernate.html",
 		},
+		"Auto Stop After": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "Stop the target after this duration without activity, e.g. 30m or 2h. A target is active while a terminal\n" +
+				"or SSH session is open, or while its workspaces keep the CPU busy. The target is stopped with the Stop Behavior.\n" +
+				"Leave blank to never stop the target automatically.",
+		},
+		"Schedule": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The times the target is started and stopped at, as cron expressions (minute hour day month weekday),\n" +
+				"e.g. start=0 8 * * mon-fri; stop=0 19 * * mon-fri. Either may be left out, e.g. stop=0 20 * * * to only stop\n" +
+				"the target at night. A target started or stopped manually stays so until the next scheduled start or stop.\n" +
+				"Leave blank to only start and stop the target manually.",
+		},
+		"Schedule Timezone": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeString,
+			DefaultValue: "UTC",
+			Description:  "The IANA timezone of the Schedule, e.g. Europe/Berlin or America/New_York.",
+		},
+		"TTL": models.TargetConfigProperty{
+			Type: models.TargetConfigPropertyTypeString,
+			Description: "The lifetime of the target, e.g. 8h or 72h, for ephemeral targets such as review environments.\n" +
+				"The expiry time is recorded in the DaytonaExpiresAt instance tag when the instance is launched, and the\n" +
+				"TTL Action is applied once it passes. Leave blank for targets that never expire.",
+		},
+		"TTL Action": models.TargetConfigProperty{
+			Type:         models.TargetConfigPropertyTypeOption,
+			DefaultValue: TTLActionStop,
+			Options:      []string{TTLActionStop, TTLActionTerminate},
+			Description: "What happens to the target once its TTL passes. With stop, the instance is stopped and can no longer\n" +
+				"be started. With terminate, the instance is terminated and the resources of the target are deleted.",
+		},
+	}
+}
+
+// GetDefaultTargetOptions returns the target options built from the default
+// values of the target config manifest and the environment.
+func GetDefaultTargetOptions() (*TargetOptions, error) {
+	defaultOptions, err := getDefaultOptionValues()
+	if err != nil {
+		return nil, err
+	}
+
+	optionsJson, err := json.Marshal(defaultOptions)
+	if err != nil {
+		return nil, err
 	}
+
+	return ParseTargetOptions(string(optionsJson))
 }
 
 // ParseTargetOptions parses the target options from the JSON string.
@@ -81,14 +379,23 @@ func ParseTargetOptions(optionsJson string) (*TargetOptions, error) {
 		return nil, err
 	}
 
-	if targetOptions.AccessKeyId == "" {
+	if targetOptions.Profile == "" {
+		profile, ok := os.LookupEnv("AWS_PROFILE")
+		if ok {
+			targetOptions.Profile = profile
+		}
+	}
+
+	// Static keys from the environment would take precedence over an explicitly
+	// configured profile, so they are only picked up when no profile is set.
+	if targetOptions.AccessKeyId == "" && targetOptions.Profile == "" {
 		accessKeyId, ok := os.LookupEnv("AWS_ACCESS_KEY_ID")
 		if ok {
 			targetOptions.AccessKeyId = accessKeyId
 		}
 	}
 
-	if targetOptions.SecretAccessKey == "" {
+	if targetOptions.SecretAccessKey == "" && targetOptions.Profile == "" {
 		secretAccessKey, ok := os.LookupEnv("AWS_SECRET_ACCESS_KEY")
 		if ok {
 			targetOptions.SecretAccessKey = secretAccessKey
@@ -102,11 +409,11 @@ func ParseTargetOptions(optionsJson string) (*TargetOptions, error) {
 		}
 	}
 
-	if targetOptions.AccessKeyId == "" {
+	if targetOptions.AccessKeyId == "" && targetOptions.SecretAccessKey != "" {
 		return nil, fmt.Errorf("access key id not set in env/target options")
 	}
 
-	if targetOptions.SecretAccessKey == "" {
+	if targetOptions.SecretAccessKey == "" && targetOptions.AccessKeyId != "" {
 		return nil, fmt.Errorf("secret access key not set in env/target options")
 	}
 
@@ -114,5 +421,140 @@ func ParseTargetOptions(optionsJson string) (*TargetOptions, error) {
 		return nil, fmt.Errorf("region not set in env/target options")
 	}
 
+	if targetOptions.RoleArn != "" && !strings.HasPrefix(targetOptions.RoleArn, "arn:") {
+		return nil, fmt.Errorf("invalid role ARN: %s", targetOptions.RoleArn)
+	}
+
+	if targetOptions.ImageId != "" && !strings.HasPrefix(targetOptions.ImageId, "ami-") &&
+		!strings.HasPrefix(targetOptions.ImageId, ImageIdSsmPrefix) && !strings.Contains(targetOptions.ImageId, ":") {
+		return nil, fmt.Errorf("invalid image id: %s", targetOptions.ImageId)
+	}
+
+	switch targetOptions.PurchasingOption {
+	case "", PurchasingOptionOnDemand, PurchasingOptionSpot, PurchasingOptionSpotWithFallback:
+	default:
+		return nil, fmt.Errorf("invalid purchasing option: %s", targetOptions.PurchasingOption)
+	}
+
+	switch targetOptions.SecretsStore {
+	case "", SecretsStoreSsmParameter, SecretsStoreUserData:
+	default:
+		return nil, fmt.Errorf("invalid secrets store: %s", targetOptions.SecretsStore)
+	}
+
+	switch targetOptions.StopBehavior {
+	case "", StopBehaviorStop, StopBehaviorHibernate:
+	default:
+		return nil, fmt.Errorf("invalid stop behavior: %s", targetOptions.StopBehavior)
+	}
+
+	if targetOptions.AutoStopAfter != "" {
+		autoStopAfter, err := time.ParseDuration(targetOptions.AutoStopAfter)
+		if err != nil || (autoStopAfter != 0 && autoStopAfter < MinAutoStopAfter) {
+			return nil, fmt.Errorf("invalid auto stop after: %s, must be a duration of at least %s", targetOptions.AutoStopAfter, MinAutoStopAfter)
+		}
+	}
+
+	if targetOptions.TTL != "" {
+		ttl, err := time.ParseDuration(targetOptions.TTL)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid TTL: %s, must be a duration such as 8h", targetOptions.TTL)
+		}
+	}
+
+	switch targetOptions.TTLAction {
+	case "", TTLActionStop, TTLActionTerminate:
+	default:
+		return nil, fmt.Errorf("invalid TTL action: %s", targetOptions.TTLAction)
+	}
+
+	_, err = targetOptions.GetSchedule()
+	if err != nil {
+		return nil, err
+	}
+
+	if targetOptions.SpotMaxPrice != "" {
+		maxPrice, err := strconv.ParseFloat(targetOptions.SpotMaxPrice, 64)
+		if err != nil || maxPrice <= 0 {
+			return nil, fmt.Errorf("invalid spot max price: %s", targetOptions.SpotMaxPrice)
+		}
+	}
+
+	err = validateVolumePerformance(targetOptions.VolumeType, targetOptions.VolumeSize, targetOptions.Iops, targetOptions.Throughput)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateDataVolume(&targetOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if targetOptions.KmsKeyId != "" && !targetOptions.EncryptVolume {
+		return nil, fmt.Errorf("KMS key id %s requires volume encryption", targetOptions.KmsKeyId)
+	}
+
+	for _, subnetId := range targetOptions.SubnetIdList() {
+		if !strings.HasPrefix(subnetId, "subnet-") {
+			return nil, fmt.Errorf("invalid subnet id: %s", subnetId)
+		}
+	}
+
+	for _, securityGroupId := range targetOptions.SecurityGroupIdList() {
+		if !strings.HasPrefix(securityGroupId, "sg-") {
+			return nil, fmt.Errorf("invalid security group id: %s", securityGroupId)
+		}
+	}
+
 	return &targetOptions, nil
 }
+
+// AutoStopDuration returns the duration without activity after which the
+// target is stopped, or zero if it is never stopped automatically.
+func (o *TargetOptions) AutoStopDuration() time.Duration {
+	autoStopAfter, err := time.ParseDuration(o.AutoStopAfter)
+	if err != nil {
+		return 0
+	}
+	return autoStopAfter
+}
+
+// TTLDuration returns the lifetime of the target, or zero if it never expires.
+func (o *TargetOptions) TTLDuration() time.Duration {
+	ttl, err := time.ParseDuration(o.TTL)
+	if err != nil {
+		return 0
+	}
+	return ttl
+}
+
+// GetSchedule returns the start and stop schedule of the target, or nil if
+// the target has none.
+func (o *TargetOptions) GetSchedule() (*schedule.Schedule, error) {
+	if strings.TrimSpace(o.Schedule) == "" {
+		return nil, nil
+	}
+	return schedule.Parse(o.Schedule, o.ScheduleTimezone)
+}
+
+// SubnetIdList returns the configured subnet ids.
+func (o *TargetOptions) SubnetIdList() []string {
+	return splitList(o.SubnetIds)
+}
+
+// SecurityGroupIdList returns the configured security group ids.
+func (o *TargetOptions) SecurityGroupIdList() []string {
+	return splitList(o.SecurityGroupIds)
+}
+
+// splitList splits a comma separated list and drops empty entries.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
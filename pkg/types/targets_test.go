@@ -11,8 +11,14 @@ func TestGetTargetManifest(t *testing.T) {
 		t.Fatalf("Expected target manifest but got nil")
 	}
 
-	fields := [8]string{"Region", "Image Id", "Instance Type", "Device Name",
-		"Volume Size", "Volume Type", "Access Key Id", "Secret Access Key",
+	fields := [38]string{"Region", "Image Id", "Instance Type", "Device Name",
+		"Volume Size", "Volume Type", "Access Key Id", "Secret Access Key", "Profile",
+		"Role ARN", "External Id", "Role Session Name", "Subnet Ids", "Security Group Ids",
+		"Associate Public IP", "Purchasing Option", "Spot Max Price", "Keep On Failure",
+		"Secrets Store", "Additional User Data", "User Data Bucket", "User Data Prefix", "Encrypt Volume",
+		"KMS Key Id", "IOPS", "Throughput", "Data Volume Size", "Data Volume Type", "Data Volume IOPS",
+		"Data Volume Throughput", "Data Volume Mount Path", "Data Volume Deletion Policy", "Stop Behavior", "Auto Stop After",
+		"Schedule", "Schedule Timezone", "TTL", "TTL Action",
 	}
 	for _, field := range fields {
 		if _, ok := (*targetManifest)[field]; !ok {
@@ -21,6 +27,25 @@ func TestGetTargetManifest(t *testing.T) {
 	}
 }
 
+func TestGetDefaultTargetOptions(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+
+	targetOptions, err := GetDefaultTargetOptions()
+	if err != nil {
+		t.Fatalf("GetDefaultTargetOptions() error = %v", err)
+	}
+
+	if targetOptions.Region != "us-east-1" {
+		t.Errorf("Expected region us-east-1 but got %s", targetOptions.Region)
+	}
+
+	if targetOptions.VolumeSize != 20 {
+		t.Errorf("Expected volume size 20 but got %d", targetOptions.VolumeSize)
+	}
+}
+
 func TestParseTargetOptions(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -86,13 +111,279 @@ func TestParseTargetOptions(t *testing.T) {
 			wantErr:     true,
 		},
 		{
-			name: "Missing credentials in both JSON and env vars",
+			name: "Missing credentials in both JSON and env vars, using default credential chain",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Image Id": "ami-12345678"
+			}`,
+			envVars: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "",
+				"AWS_SECRET_ACCESS_KEY": "",
+				"AWS_PROFILE":           "",
+			},
+			want: &TargetOptions{
+				Region:  "us-east-1",
+				ImageId: "ami-12345678",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Profile from env var takes precedence over env credentials",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Image Id": "ami-12345678"
+			}`,
+			envVars: map[string]string{
+				"AWS_ACCESS_KEY_ID":     "accessKeyID",
+				"AWS_SECRET_ACCESS_KEY": "secretAccessKey",
+				"AWS_PROFILE":           "dev",
+			},
+			want: &TargetOptions{
+				Region:  "us-east-1",
+				ImageId: "ami-12345678",
+				Profile: "dev",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid JSON with role to assume",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Profile": "tooling",
+				"Role ARN": "arn:aws:iam::123456789012:role/daytona",
+				"External Id": "externalId",
+				"Role Session Name": "daytona"
+			}`,
+			want: &TargetOptions{
+				Region:          "us-east-1",
+				Profile:         "tooling",
+				RoleArn:         "arn:aws:iam::123456789012:role/daytona",
+				ExternalId:      "externalId",
+				RoleSessionName: "daytona",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid role ARN",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Role ARN": "daytona"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Valid JSON with network options",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Subnet Ids": "subnet-0123, subnet-4567",
+				"Security Group Ids": "sg-0123",
+				"Associate Public IP": false
+			}`,
+			want: &TargetOptions{
+				Region:            "us-east-1",
+				SubnetIds:         "subnet-0123, subnet-4567",
+				SecurityGroupIds:  "sg-0123",
+				AssociatePublicIp: new(bool),
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid subnet id",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Subnet Ids": "vpc-0123"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Valid JSON with spot purchasing option",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Purchasing Option": "spot-with-on-demand-fallback",
+				"Spot Max Price": "0.05"
+			}`,
+			want: &TargetOptions{
+				Region:           "us-east-1",
+				PurchasingOption: "spot-with-on-demand-fallback",
+				SpotMaxPrice:     "0.05",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid JSON with SSM parameter image id",
+			optionsJson: `{
+				"Region": "eu-central-1",
+				"Image Id": "resolve:ssm:/aws/service/canonical/ubuntu/server/24.04/stable/current/amd64/hvm/ebs-gp3/ami-id"
+			}`,
+			want: &TargetOptions{
+				Region:  "eu-central-1",
+				ImageId: "resolve:ssm:/aws/service/canonical/ubuntu/server/24.04/stable/current/amd64/hvm/ebs-gp3/ami-id",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Valid JSON with owner and name pattern image id",
+			optionsJson: `{
+				"Region": "eu-central-1",
+				"Image Id": "099720109477:ubuntu/images/*ubuntu-noble-24.04-amd64-server-*"
+			}`,
+			want: &TargetOptions{
+				Region:  "eu-central-1",
+				ImageId: "099720109477:ubuntu/images/*ubuntu-noble-24.04-amd64-server-*",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Invalid image id",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Image Id": "ubuntu"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid purchasing option",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Purchasing Option": "reserved"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid spot max price",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Purchasing Option": "spot",
+				"Spot Max Price": "cheap"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Valid JSON with KMS key",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Encrypt Volume": true,
+				"KMS Key Id": "alias/daytona"
+			}`,
+			want: &TargetOptions{
+				Region:        "us-east-1",
+				EncryptVolume: true,
+				KmsKeyId:      "alias/daytona",
+			},
+			wantErr: false,
+		},
+		{
+			name: "KMS key without volume encryption",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"KMS Key Id": "alias/daytona"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Valid JSON with provisioned IOPS",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Volume Type": "gp3",
+				"Volume Size": 100,
+				"IOPS": 6000,
+				"Throughput": 500
+			}`,
+			want: &TargetOptions{
+				Region:     "us-east-1",
+				VolumeType: "gp3",
+				VolumeSize: 100,
+				Iops:       6000,
+				Throughput: 500,
+			},
+			wantErr: false,
+		},
+		{
+			name: "Provisioned IOPS without volume type support",
 			optionsJson: `{
 				"Region": "us-east-1",
-				"Image ID": "ami-12345678"
+				"Volume Type": "gp2",
+				"IOPS": 6000
 			}`,
 			wantErr: true,
 		},
+		{
+			name: "Invalid secrets store",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Secrets Store": "vault"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid stop behavior",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Stop Behavior": "suspend"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid auto stop after",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Auto Stop After": "30"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Auto stop after below the minimum",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Auto Stop After": "1m"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid schedule",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Schedule": "start=0 8 * * mon-fri; stop=19:00"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid schedule timezone",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Schedule": "stop=0 19 * * *",
+				"Schedule Timezone": "Europe/Atlantis"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid TTL",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"TTL": "3d"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Invalid TTL action",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"TTL": "8h",
+				"TTL Action": "hibernate"
+			}`,
+			wantErr: true,
+		},
+		{
+			name: "Access key id without secret access key",
+			optionsJson: `{
+				"Region": "us-east-1",
+				"Access Key Id": "accessKeyID"
+			}`,
+			envVars: map[string]string{
+				"AWS_SECRET_ACCESS_KEY": "",
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -112,3 +403,13 @@ func TestParseTargetOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestSubnetIdList(t *testing.T) {
+	targetOptions := &TargetOptions{SubnetIds: " subnet-0123,,subnet-4567 "}
+
+	want := []string{"subnet-0123", "subnet-4567"}
+	got := targetOptions.SubnetIdList()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SubnetIdList() = %v, want %v", got, want)
+	}
+}
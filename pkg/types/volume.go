@@ -0,0 +1,119 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// mountPathRegex matches absolute paths that are safe to use in the bootstrap script
+var mountPathRegex = regexp.MustCompile(`^(/[A-Za-z0-9._-]+)+$`)
+
+// volumeIopsLimits are the provisioned IOPS limits of the EBS volume types
+// that support them.
+// https://docs.aws.amazon.com/ebs/latest/userguide/ebs-volume-types.html
+var volumeIopsLimits = map[string]struct {
+	Min int
+	Max int
+	// MaxPerGiB is the maximum ratio of IOPS to volume size
+	MaxPerGiB int
+	// Baseline is the IOPS of the volume type at any size without provisioned IOPS
+	Baseline int
+	// Required is true if the volume type has no baseline IOPS
+	Required bool
+}{
+	"gp3": {Min: 3000, Max: 80000, MaxPerGiB: 500, Baseline: gp3BaselineIops},
+	"io1": {Min: 100, Max: 64000, MaxPerGiB: 50, Required: true},
+	"io2": {Min: 100, Max: 256000, MaxPerGiB: 1000, Required: true},
+}
+
+const (
+	// gp3BaselineIops is the IOPS of a gp3 volume without provisioned IOPS
+	gp3BaselineIops  = 3000
+	gp3MinThroughput = 125
+	gp3MaxThroughput = 2000
+	// gp3MaxThroughputPerIops is the maximum ratio of throughput, in MiB/s, to IOPS
+	gp3MaxThroughputPerIops = 0.25
+)
+
+// validateVolumePerformance validates the provisioned IOPS and throughput, in
+// MiB/s, of a volume. Zero values leave the volume at its baseline.
+func validateVolumePerformance(volumeType string, size, iops, throughput int) error {
+	if iops < 0 || throughput < 0 {
+		return fmt.Errorf("IOPS and throughput must not be negative")
+	}
+
+	limits, ok := volumeIopsLimits[volumeType]
+	if !ok {
+		if iops > 0 {
+			return fmt.Errorf("volume type %s does not support provisioned IOPS", volumeType)
+		}
+	} else if iops == 0 {
+		if limits.Required {
+			return fmt.Errorf("volume type %s requires provisioned IOPS", volumeType)
+		}
+	} else {
+		if iops < limits.Min || iops > limits.Max {
+			return fmt.Errorf("IOPS of volume type %s must be between %d and %d, got %d", volumeType, limits.Min, limits.Max, iops)
+		}
+
+		if size > 0 && iops > limits.Baseline && iops > limits.MaxPerGiB*size {
+			return fmt.Errorf("IOPS of volume type %s must be at most %d per GiB, %d IOPS require a volume of at least %d GiB",
+				volumeType, limits.MaxPerGiB, iops, (iops+limits.MaxPerGiB-1)/limits.MaxPerGiB)
+		}
+	}
+
+	if throughput == 0 {
+		return nil
+	}
+
+	if volumeType != "gp3" {
+		return fmt.Errorf("volume type %s does not support provisioned throughput", volumeType)
+	}
+
+	if throughput < gp3MinThroughput || throughput > gp3MaxThroughput {
+		return fmt.Errorf("throughput of volume type gp3 must be between %d and %d MiB/s, got %d", gp3MinThroughput, gp3MaxThroughput, throughput)
+	}
+
+	if iops == 0 {
+		iops = gp3BaselineIops
+	}
+	if float64(throughput) > float64(iops)*gp3MaxThroughputPerIops {
+		return fmt.Errorf("throughput of volume type gp3 must be at most %.2f MiB/s per IOPS, %d MiB/s require at least %d IOPS",
+			gp3MaxThroughputPerIops, throughput, int(float64(throughput)/gp3MaxThroughputPerIops))
+	}
+
+	return nil
+}
+
+// validateDataVolume validates the data volume options. They are only
+// validated if the target has a data volume.
+func validateDataVolume(opts *TargetOptions) error {
+	switch opts.DataVolumeDeletionPolicy {
+	case "", DeletionPolicyDelete, DeletionPolicyRetain:
+	default:
+		return fmt.Errorf("invalid data volume deletion policy: %s", opts.DataVolumeDeletionPolicy)
+	}
+
+	if opts.DataVolumeSize < 0 {
+		return fmt.Errorf("invalid data volume size: %d", opts.DataVolumeSize)
+	}
+
+	if opts.DataVolumeSize == 0 {
+		return nil
+	}
+
+	if opts.DataVolumeType == "" {
+		return fmt.Errorf("data volume type not set")
+	}
+
+	err := validateVolumePerformance(opts.DataVolumeType, opts.DataVolumeSize, opts.DataVolumeIops, opts.DataVolumeThroughput)
+	if err != nil {
+		return fmt.Errorf("invalid data volume: %w", err)
+	}
+
+	if !mountPathRegex.MatchString(opts.DataVolumeMountPath) {
+		return fmt.Errorf("invalid data volume mount path: %s", opts.DataVolumeMountPath)
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package types
+
+import "testing"
+
+func TestValidateVolumePerformance(t *testing.T) {
+	tests := []struct {
+		name       string
+		volumeType string
+		size       int
+		iops       int
+		throughput int
+		wantErr    bool
+	}{
+		{name: "gp3 baseline", volumeType: "gp3", size: 20},
+		{name: "gp3 baseline IOPS on a small volume", volumeType: "gp3", size: 1, iops: 3000},
+		{name: "gp3 provisioned", volumeType: "gp3", size: 100, iops: 16000, throughput: 1000},
+		{name: "gp3 baseline IOPS with throughput", volumeType: "gp3", size: 20, throughput: 750},
+		{name: "gp3 IOPS under minimum", volumeType: "gp3", size: 100, iops: 2000, wantErr: true},
+		{name: "gp3 maximum", volumeType: "gp3", size: 160, iops: 80000, throughput: 2000},
+		{name: "gp3 IOPS over maximum", volumeType: "gp3", size: 1000, iops: 90000, wantErr: true},
+		{name: "gp3 IOPS over ratio", volumeType: "gp3", size: 20, iops: 12000, wantErr: true},
+		{name: "gp3 throughput under minimum", volumeType: "gp3", size: 20, throughput: 100, wantErr: true},
+		{name: "gp3 throughput over maximum", volumeType: "gp3", size: 1000, iops: 80000, throughput: 2500, wantErr: true},
+		{name: "gp3 throughput over IOPS ratio", volumeType: "gp3", size: 20, throughput: 800, wantErr: true},
+		{name: "io1 provisioned", volumeType: "io1", size: 100, iops: 5000},
+		{name: "io1 without IOPS", volumeType: "io1", size: 100, wantErr: true},
+		{name: "io1 IOPS over ratio", volumeType: "io1", size: 100, iops: 6000, wantErr: true},
+		{name: "io1 with throughput", volumeType: "io1", size: 100, iops: 5000, throughput: 500, wantErr: true},
+		{name: "io2 provisioned", volumeType: "io2", size: 100, iops: 100000},
+		{name: "io2 IOPS over ratio", volumeType: "io2", size: 50, iops: 60000, wantErr: true},
+		{name: "io2 IOPS over maximum", volumeType: "io2", size: 1000, iops: 300000, wantErr: true},
+		{name: "gp2 baseline", volumeType: "gp2", size: 20},
+		{name: "gp2 with IOPS", volumeType: "gp2", size: 20, iops: 3000, wantErr: true},
+		{name: "st1 with throughput", volumeType: "st1", size: 500, throughput: 250, wantErr: true},
+		{name: "negative IOPS", volumeType: "gp3", size: 20, iops: -1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVolumePerformance(tt.volumeType, tt.size, tt.iops, tt.throughput)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateVolumePerformance() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateDataVolume(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    TargetOptions
+		wantErr bool
+	}{
+		{name: "No data volume", opts: TargetOptions{}},
+		{name: "Data volume", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "gp3", DataVolumeMountPath: "/data"}},
+		{name: "Nested mount path", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "st1", DataVolumeMountPath: "/mnt/daytona-data"}},
+		{name: "Retained data volume", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "gp3", DataVolumeMountPath: "/data", DataVolumeDeletionPolicy: "retain"}},
+		{name: "Invalid deletion policy", opts: TargetOptions{DataVolumeDeletionPolicy: "snapshot"}, wantErr: true},
+		{name: "Negative size", opts: TargetOptions{DataVolumeSize: -1}, wantErr: true},
+		{name: "Missing type", opts: TargetOptions{DataVolumeSize: 100, DataVolumeMountPath: "/data"}, wantErr: true},
+		{name: "Type requiring IOPS", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "io2", DataVolumeMountPath: "/data"}, wantErr: true},
+		{name: "Provisioned IOPS", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "io2", DataVolumeIops: 10000, DataVolumeMountPath: "/data"}},
+		{name: "Provisioned throughput", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "gp3", DataVolumeIops: 6000, DataVolumeThroughput: 500, DataVolumeMountPath: "/data"}},
+		{name: "Throughput of a type without it", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "io2", DataVolumeIops: 10000, DataVolumeThroughput: 500, DataVolumeMountPath: "/data"}, wantErr: true},
+		{name: "Relative mount path", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "gp3", DataVolumeMountPath: "data"}, wantErr: true},
+		{name: "Root mount path", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "gp3", DataVolumeMountPath: "/"}, wantErr: true},
+		{name: "Mount path with trailing slash", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "gp3", DataVolumeMountPath: "/data/"}, wantErr: true},
+		{name: "Mount path with shell characters", opts: TargetOptions{DataVolumeSize: 100, DataVolumeType: "gp3", DataVolumeMountPath: "/data;reboot"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDataVolume(&tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateDataVolume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}